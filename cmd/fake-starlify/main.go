@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	stargazerkafka "github.com/entiros/stargazer-kafka/internal/stargazer-kafka"
+	"github.com/entiros/stargazer-kafka/internal/starlify/fake"
+)
+
+// fake-starlify serves a fake Starlify API with one Kafka agent and middleware, to run the agent locally.
+func main() {
+
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	apiKey := flag.String("api-key", "api-key-123", "API key clients must send, empty accepts any key")
+	agentId := flag.String("agent", "agent-id-123", "Id of the Kafka agent")
+	middlewareId := flag.String("middleware", "system-id-123", "Id of the Kafka middleware")
+	kafkaPrefix := flag.String("prefix", "e12345678.", "Kafka prefix of the middleware")
+	endpoints := flag.String("endpoints", "", "Comma separated endpoints (topic names) to start with")
+	flag.Parse()
+
+	s := fake.New(*apiKey)
+	s.AddMiddleware(*middlewareId, "Kafka", *kafkaPrefix)
+	s.AddAgent(*agentId, stargazerkafka.KafkaType, *middlewareId)
+	for _, name := range strings.Split(*endpoints, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if _, err := s.AddEndpoint(*middlewareId, name); err != nil {
+				log.Logger.Fatal(err)
+			}
+		}
+	}
+
+	log.Logger.Infof("Fake Starlify listening on %s, baseUrl: http://localhost%s%s, agentId: %s, middlewareId: %s, apiKey: %s",
+		*addr, *addr, fake.BasePath, *agentId, *middlewareId, *apiKey)
+
+	log.Logger.Fatal(http.ListenAndServe(*addr, s.Handler()))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/status"
+	"github.com/gin-gonic/gin"
+)
+
+// addAdminRoutes adds the system status and control API. The API is only enabled when a token is configured,
+// and every request must carry it as a bearer token.
+func addAdminRoutes(router *gin.Engine, token string) {
+
+	if token == "" {
+		log.Logger.Debugf("ADMIN_TOKEN not set, admin API disabled")
+		return
+	}
+
+	admin := router.Group("/systems", authenticate(token))
+	admin.GET("", listSystems())
+	admin.POST("/:name/sync", syncSystem())
+	admin.POST("/:name/pause", pauseSystem(true))
+	admin.POST("/:name/resume", pauseSystem(false))
+
+	router.GET("/prefixes/unmanaged", authenticate(token), listUnmanagedPrefixes())
+	router.GET("/topics/orphaned", authenticate(token), listOrphanedTopics())
+}
+
+// authenticate accepts only requests with the header "Authorization: Bearer <token>".
+func authenticate(token string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		given := strings.TrimPrefix(header, "Bearer ")
+		if !strings.HasPrefix(header, "Bearer ") || given == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+}
+
+func listSystems() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, status.Systems())
+	}
+}
+
+func listUnmanagedPrefixes() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, status.Unmanaged())
+	}
+}
+
+func listOrphanedTopics() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, status.Orphans())
+	}
+}
+
+func syncSystem() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		s, ok := status.Find(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown system"})
+			return
+		}
+		if s.Paused {
+			c.JSON(http.StatusConflict, gin.H{"error": "system is paused"})
+			return
+		}
+
+		log.Logger.Infof("Sync of %s requested", s.Name)
+		status.Trigger(s.Name)
+		c.JSON(http.StatusAccepted, s)
+	}
+}
+
+func pauseSystem(paused bool) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !status.SetPaused(c.Param("name"), paused) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown system"})
+			return
+		}
+
+		s, _ := status.Find(c.Param("name"))
+		log.Logger.Infof("Sync of %s paused: %v", s.Name, paused)
+		c.JSON(http.StatusOK, s)
+	}
+}
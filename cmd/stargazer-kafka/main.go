@@ -4,10 +4,16 @@ import (
 	"context"
 	"fmt"
 	"github.com/entiros/stargazer-kafka/internal/config"
+	"github.com/entiros/stargazer-kafka/internal/kafka"
 	"github.com/entiros/stargazer-kafka/internal/log"
 	"github.com/entiros/stargazer-kafka/internal/metrics"
+	stargazerkafka "github.com/entiros/stargazer-kafka/internal/stargazer-kafka"
+	"github.com/entiros/stargazer-kafka/internal/status"
 	"github.com/entiros/stargazer-kafka/internal/system"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
+	"github.com/entiros/stargazer-kafka/internal/webhook"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 	"net/http"
@@ -20,6 +26,9 @@ import (
 
 var DefaultHealthPort = 8081
 var DefaultMetricsPort = 9090
+var DefaultLivenessStaleness = 5 * time.Minute
+var SyncInterval = 20 * time.Second
+var WebhookWorkers = 4
 
 func makeDir(dir string) error {
 
@@ -55,6 +64,18 @@ func main() {
 
 	log.Logger.Debugf("Using config from: %s", fileName)
 
+	shutdownTracing, err := tracing.Init(ctx, tracingOptions())
+	if err != nil {
+		log.Logger.Fatal(err)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Logger.Infof("Failed to flush traces: %v", err)
+		}
+	}()
+
 	srvGroup, srvContext := errgroup.WithContext(ctx)
 
 	srvGroup.Go(func() error {
@@ -65,12 +86,18 @@ func main() {
 		return runMetricsServer(srvContext, metricsPort())
 	})
 
+	srvGroup.Go(func() error {
+		webhook.Run(srvContext, WebhookWorkers)
+		return nil
+	})
+
 	srvGroup.Go(func() error {
 		return runSync(srvContext, fileName)
 	})
 
 	log.Logger.Debugf("Stargazer running.")
 	shutdownErr := srvGroup.Wait()
+	kafka.CloseProducers()
 
 	if shutdownErr != nil && shutdownErr != http.ErrServerClosed {
 		log.Logger.Errorf("Shutdown with error: %v", shutdownErr)
@@ -84,46 +111,217 @@ func runSync(ctx context.Context, fileName string) error {
 
 loop:
 	for {
-		next, hasNext := getSystems(fileName, ctx)
-
-		var prefixes []string
-		for hasNext() {
-			sys, err := next()
-			if err != nil {
-				metrics.ErrCount.Add(1)
-				log.Logger.Errorf("Failed to sync. %v", err)
-				continue
+		syncCycle(ctx, fileName)
+		next := time.After(SyncInterval)
+
+		// Systems requested through the admin API are synced on their own until the next cycle is due.
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-next:
+				break wait
+			case <-status.Triggered():
+				for _, name := range status.Requested() {
+					log.Logger.Debugf("Sync of %s triggered", name)
+					syncRequested(ctx, name)
+				}
 			}
+		}
+	}
 
-			err = sys.PingStarlify(ctx)
-			if err != nil {
-				metrics.ErrCount.Add(1)
-				log.Logger.Errorf("failed to ping starlify. %v", err)
-			}
-			prefix, err := sys.SyncTopics(ctx)
-			if err != nil {
-				metrics.ErrCount.Add(1)
-				log.Logger.Errorf("failed to sync topics for %s, %v ", sys.Name(), err)
-				time.Sleep(3 * time.Second)
-				continue
+	return nil
+}
+
+// syncCycle syncs all configured systems, then looks for the prefixes and topics that none of them manages.
+func syncCycle(ctx context.Context, fileName string) {
+
+	// Systems on the same cluster share one metadata snapshot per cycle.
+	kafka.ResetMetadata()
+
+	next, hasNext := getSystems(fileName, ctx)
+
+	discovery := system.NewDiscovery()
+	var prefixes []string
+	var names []string
+	for hasNext() {
+		name, sys, err := next()
+		if name != "" {
+			names = append(names, name)
+		}
+		if err != nil {
+			countError(name, err)
+			if name != "" {
+				status.Failed(name, err)
+
+				// The prefix of the last successful sync counts as managed until the system initialises again.
+				var prefix string
+				if s, ok := status.Find(name); ok {
+					prefix = s.Prefix
+				}
+				discovery.AddFailed(name, prefix)
 			}
-			metrics.SyncCount.Add(1)
-			time.Sleep(3 * time.Second)
-			prefixes = append(prefixes, prefix)
+			log.Logger.Errorf("Failed to sync. %v", err)
+			continue
 		}
+		status.Initialised(name, sys.Direction())
 
-		// Find all Kafka prefixes (systems) that we did not loop through.
-		log.Logger.Debugf("Processed prefixes: %v", prefixes)
+		// The prefix of the last successful sync counts as managed until this sync succeeds.
+		if s, ok := status.Find(name); ok {
+			discovery.Add(sys, s.Prefix)
+		}
 
-		select {
-		case <-ctx.Done():
-			break loop
-		case <-time.After(10 * time.Second):
+		if status.Paused(name) {
+			log.Logger.Debugf("Sync of %s is paused", name)
+			discovery.Pause(sys)
+			continue
 		}
-		time.Sleep(10 * time.Second)
+
+		prefix, err := runSystem(ctx, name, sys)
+		time.Sleep(3 * time.Second)
+		if err != nil {
+			continue
+		}
+		discovery.Add(sys, prefix)
+		prefixes = append(prefixes, prefix)
 	}
 
-	return nil
+	// Find all Kafka prefixes (systems) that we did not loop through.
+	log.Logger.Debugf("Processed prefixes: %v", prefixes)
+	unmanaged := discovery.Unmanaged(ctx)
+	for cluster, p := range unmanaged {
+		if len(p) > 0 {
+			log.Logger.Infof("Prefixes without a system in %s: %v", cluster, p)
+		}
+	}
+	metrics.SetUnmanagedPrefixes(unmanaged)
+	status.SetUnmanaged(unmanaged)
+	discovery.Report(ctx, unmanaged)
+	orphans := discovery.Orphans(ctx)
+	metrics.SetOrphanedTopics(orphans)
+	status.SetOrphans(orphans)
+	status.CycleCompleted(names, time.Now().Add(SyncInterval))
+}
+
+// syncRequested syncs the system called name outside of a cycle, unless it is paused.
+func syncRequested(ctx context.Context, name string) {
+
+	kafka.ResetMetadata()
+
+	sys, err := system.NewSystem(ctx, name)
+	if err != nil {
+		countError(name, err)
+		status.Failed(name, err)
+		log.Logger.Errorf("Failed to sync. %v", err)
+		return
+	}
+	status.Initialised(name, sys.Direction())
+
+	if status.Paused(name) {
+		log.Logger.Debugf("Sync of %s is paused", name)
+		return
+	}
+	runSystem(ctx, name, sys)
+}
+
+// runSystem syncs the topics, ACLs and lag of the system and returns the prefix it synced.
+// An error is returned only if the topics could not be synced.
+func runSystem(ctx context.Context, name string, sys *system.System) (string, error) {
+
+	err := sys.PingStarlify(ctx)
+	if err != nil {
+		countError(name, err)
+		log.Logger.Errorf("failed to ping starlify. %v", err)
+	}
+	syncCtx, span := tracing.Start(ctx, "sync", attribute.String("system", name))
+	start := time.Now()
+	prefix, err := sys.SyncTopics(syncCtx)
+	if err != nil {
+		countError(name, err)
+		status.Failed(name, err)
+		log.Ctx(syncCtx).Errorf("failed to sync topics for %s, %v ", sys.Name(), err)
+		reportError(syncCtx, name, sys, err)
+		tracing.End(span, err)
+		return "", err
+	}
+	span.SetAttributes(attribute.String("prefix", prefix))
+	metrics.SyncDuration.WithLabelValues(name, prefix).Observe(time.Since(start).Seconds())
+	metrics.LastSuccessfulSync.WithLabelValues(name, prefix).SetToCurrentTime()
+	status.Synced(name, prefix)
+
+	// The error shown in Starlify is the first of the cycle, cleared when the cycle succeeds.
+	var cycleErr error
+	err = sys.SyncACLs(syncCtx)
+	if err != nil {
+		countError(name, err)
+		log.Ctx(syncCtx).Errorf("failed to sync ACLs for %s, %v ", sys.Name(), err)
+		cycleErr = err
+	}
+	err = sys.ReportLag(syncCtx, prefix)
+	if err != nil {
+		countError(name, err)
+		log.Ctx(syncCtx).Errorf("failed to report lag for %s, %v ", sys.Name(), err)
+		if cycleErr == nil {
+			cycleErr = err
+		}
+	}
+	reportError(syncCtx, name, sys, cycleErr)
+	tracing.End(span, nil)
+	metrics.SyncCount.Add(1)
+	return prefix, nil
+}
+
+// reportError shows err on the Starlify agent of the system, or clears the error shown if err is nil.
+func reportError(ctx context.Context, name string, sys *system.System, err error) {
+
+	var reportErr error
+	if err != nil {
+		reportErr = sys.ReportError(ctx, err)
+	} else {
+		reportErr = sys.ClearError(ctx)
+	}
+	if reportErr != nil {
+		countError(name, reportErr)
+		log.Ctx(ctx).Errorf("failed to report error to starlify for %s, %v ", sys.Name(), reportErr)
+	}
+}
+
+// countError counts err in the error metrics of the system.
+func countError(name string, err error) {
+	metrics.ErrCount.Add(1)
+	metrics.Errors.WithLabelValues(name, stargazerkafka.Category(err)).Inc()
+}
+
+func tracingOptions() tracing.Options {
+
+	opts := tracing.Options{
+		Endpoint:    os.Getenv("TRACING_ENDPOINT"),
+		Insecure:    os.Getenv("TRACING_INSECURE") == "true",
+		SampleRatio: 1.0,
+	}
+	if ratio := os.Getenv("TRACING_SAMPLE_RATIO"); ratio != "" {
+		r, err := strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			log.Logger.Errorf("Invalid TRACING_SAMPLE_RATIO %s, using %v", ratio, opts.SampleRatio)
+		} else {
+			opts.SampleRatio = r
+		}
+	}
+	return opts
+}
+
+func livenessStaleness() time.Duration {
+
+	staleness := os.Getenv("LIVENESS_STALENESS")
+	if staleness != "" {
+		d, err := time.ParseDuration(staleness)
+		if err == nil {
+			return d
+		}
+		log.Logger.Errorf("Invalid LIVENESS_STALENESS %s, using %v", staleness, DefaultLivenessStaleness)
+	}
+	return DefaultLivenessStaleness
 }
 
 func healthPort() int {
@@ -152,16 +350,16 @@ func metricsPort() int {
 	return DefaultMetricsPort
 }
 
-func errorFoo(msg error) (next func() (*system.System, error), hasNext func() bool) {
-	return func() (*system.System, error) {
-			return nil, fmt.Errorf("%v", msg)
+func errorFoo(msg error) (next func() (string, *system.System, error), hasNext func() bool) {
+	return func() (string, *system.System, error) {
+			return "", nil, fmt.Errorf("%v", msg)
 		}, func() bool {
 			return false
 		}
 
 }
 
-func getSystems(fileName string, ctx context.Context) (next func() (*system.System, error), hasNext func() bool) {
+func getSystems(fileName string, ctx context.Context) (next func() (string, *system.System, error), hasNext func() bool) {
 
 	info, err := os.Stat(fileName)
 	if err != nil {
@@ -174,20 +372,20 @@ func getSystems(fileName string, ctx context.Context) (next func() (*system.Syst
 	}
 }
 
-func GetSystem(ctx context.Context, dir string) (next func() (*system.System, error), hasNext func() bool) {
+func GetSystem(ctx context.Context, dir string) (next func() (string, *system.System, error), hasNext func() bool) {
 
 	var i int
-	return func() (*system.System, error) {
+	return func() (string, *system.System, error) {
 			s, err := system.NewSystem(ctx, dir)
 			i++
-			return s, err
+			return dir, s, err
 		}, func() bool {
 			return i < 1
 		}
 
 }
 
-func GetSystems(ctx context.Context, dir string) (next func() (*system.System, error), hasNext func() bool) {
+func GetSystems(ctx context.Context, dir string) (next func() (string, *system.System, error), hasNext func() bool) {
 
 	configFiles, err := config.GetConfigs(dir)
 	if err != nil {
@@ -199,10 +397,11 @@ func GetSystems(ctx context.Context, dir string) (next func() (*system.System, e
 
 	var i int
 
-	next = func() (*system.System, error) {
-		sys, err := system.NewSystem(ctx, configFiles[i])
+	next = func() (string, *system.System, error) {
+		file := configFiles[i]
+		sys, err := system.NewSystem(ctx, file)
 		i++
-		return sys, err
+		return file, sys, err
 	}
 
 	hasNext = func() bool {
@@ -228,15 +427,34 @@ func runMetricsServer(ctx context.Context, metricsPort int) error {
 	return runServer(ctx, metricsSrv)
 }
 
+// ready is OK once every system has been initialised, i.e. its agent type is verified and Kafka is reachable.
 func ready() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		c.Status(http.StatusOK)
+		code := http.StatusOK
+		isReady := status.Ready()
+		if !isReady {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{
+			"ready":   isReady,
+			"systems": status.Systems(),
+		})
 	}
 }
 
-func alive() func(c *gin.Context) {
+// alive fails if the sync loop has not completed a cycle within staleness.
+func alive(staleness time.Duration) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		c.Status(http.StatusOK)
+		code := http.StatusOK
+		isAlive := status.Alive(staleness)
+		if !isAlive {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{
+			"alive":     isAlive,
+			"lastCycle": status.LastCycle(),
+			"systems":   status.Systems(),
+		})
 	}
 }
 
@@ -246,7 +464,8 @@ func startHealthServer(ctx context.Context, healthPort int) error {
 	healthRouter.Use(gin.Recovery())
 	healthRouter.Use(rateLimiter(rate.NewLimiter(3.0, 1)))
 	healthRouter.GET("/readyz", ready())
-	healthRouter.GET("/livez", alive())
+	healthRouter.GET("/livez", alive(livenessStaleness()))
+	addAdminRoutes(healthRouter, os.Getenv("ADMIN_TOKEN"))
 	healthRouter.Use(gin.LoggerWithWriter(gin.DefaultWriter, "/readyz", "/livez"))
 
 	healthSrv := &http.Server{
@@ -271,7 +490,8 @@ func runServer(ctx context.Context, srv *http.Server) error {
 
 	grp.Go(func() error {
 		<-grpCtx.Done()
-		shutdownCtx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 		log.Logger.Debugf("Shutting down server: %s", srv.Addr)
 		err := srv.Shutdown(shutdownCtx)
 		if err != nil {
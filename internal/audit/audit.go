@@ -0,0 +1,168 @@
+// Package audit is an append-only trail of the changes the agent makes to Kafka, Starlify and the Schema Registry,
+// written to JSON-lines files and Kafka topics, as is or as CloudEvents.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/entiros/stargazer-kafka/internal/log"
+)
+
+// Actions of events.
+const (
+	TopicCreate     = "topic.create"
+	TopicDelete     = "topic.delete"
+	EndpointCreate  = "endpoint.create"
+	EndpointDelete  = "endpoint.delete"
+	EndpointUpdate  = "endpoint.update"
+	ACLCreate       = "acl.create"
+	ACLDelete       = "acl.delete"
+	SubjectRegister = "subject.register"
+	SubjectConfig   = "subject.compatibility"
+	SubjectDelete   = "subject.delete"
+)
+
+// Event is a change made by the agent.
+type Event struct {
+	Time      time.Time `json:"time"`
+	System    string    `json:"system"`
+	Prefix    string    `json:"prefix"`
+	Direction string    `json:"direction"`
+	Action    string    `json:"action"`
+	// Target is the name of the topic, endpoint, ACL or subject changed.
+	Target string `json:"target"`
+	// Before and After are the state of the target, Before is nil for creations and After for deletions.
+	Before *State `json:"before,omitempty"`
+	After  *State `json:"after,omitempty"`
+	// Diff is the difference that triggered the change.
+	Diff *Diff `json:"diff,omitempty"`
+}
+
+// State is the state of the target of an event. Topics and subjects have the endpoint and topic they belong to.
+type State struct {
+	Name       string            `json:"name"`
+	Id         string            `json:"id,omitempty"`
+	Endpoint   string            `json:"endpoint,omitempty"`
+	Topic      string            `json:"topic,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Diff is what a sync found to differ: the names to create and delete, or the attributes changed.
+type Diff struct {
+	Create  []string `json:"create,omitempty"`
+	Delete  []string `json:"delete,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Sink stores events.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+}
+
+// Trail writes the events of a system to its sinks. A nil Trail records nothing.
+type Trail struct {
+	System    string
+	Direction string
+	Sinks     []Sink
+}
+
+// Record stamps the events with the time, the system, its direction and prefix, and writes them to every sink.
+// It returns the first error of the sinks, after trying all of them.
+func (t *Trail) Record(ctx context.Context, prefix string, events ...Event) error {
+
+	if t == nil || len(t.Sinks) == 0 || len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for i := range events {
+		events[i].Time = now
+		events[i].System = t.System
+		events[i].Direction = t.Direction
+		events[i].Prefix = prefix
+	}
+
+	var first error
+	for _, sink := range t.Sinks {
+		if err := sink.Write(ctx, events); err != nil {
+			log.Ctx(ctx).Errorf("Failed to write %d audit events to %v: %v", len(events), sink, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// files serializes the writes to files, systems sharing a file may sync at the same time.
+var files sync.Mutex
+
+// FileSink appends events to a file as JSON lines, and syncs the file to disk before returning.
+type FileSink struct {
+	Path string
+}
+
+func (s *FileSink) String() string {
+	return "file " + s.Path
+}
+
+func (s *FileSink) Write(ctx context.Context, events []Event) error {
+
+	var lines []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	files.Lock()
+	defer files.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(lines)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// KafkaSink produces events to a topic, one JSON record per event keyed by system. The topic must exist.
+type KafkaSink struct {
+	Producer kafka.Producer
+	Topic    string
+}
+
+func (s *KafkaSink) String() string {
+	return "topic " + s.Topic
+}
+
+func (s *KafkaSink) Write(ctx context.Context, events []Event) error {
+
+	records := make([]kafka.Record, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		records = append(records, kafka.Record{Key: []byte(event.System), Value: value})
+	}
+
+	if err := s.Producer.Produce(ctx, s.Topic, records...); err != nil {
+		return fmt.Errorf("failed to produce to %s. %v", s.Topic, err)
+	}
+	return nil
+}
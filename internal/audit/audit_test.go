@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrail(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	cluster := fake.New("audit")
+	trail := &Trail{System: "orders.yaml", Direction: "kafka_to_starlify", Sinks: []Sink{
+		&FileSink{Path: path},
+		&KafkaSink{Producer: cluster, Topic: "audit"},
+	}}
+
+	changes := &Diff{Delete: []string{"e12345678.stale"}}
+	assert.NoError(t, trail.Record(ctx, "e12345678.",
+		Event{Action: TopicDelete, Target: "e12345678.stale", Before: &State{Name: "e12345678.stale"}, Diff: changes}))
+	assert.NoError(t, trail.Record(ctx, "e12345678.",
+		Event{Action: EndpointCreate, Target: "orders", After: &State{Name: "orders", Topic: "e12345678.orders"}}))
+
+	// Events are appended to the file, one per line.
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	assert.Len(t, events, 2)
+	assert.Equal(t, "orders.yaml", events[0].System)
+	assert.Equal(t, "kafka_to_starlify", events[0].Direction)
+	assert.Equal(t, "e12345678.", events[0].Prefix)
+	assert.Equal(t, TopicDelete, events[0].Action)
+	assert.Equal(t, changes, events[0].Diff)
+	assert.False(t, events[0].Time.IsZero())
+	assert.Nil(t, events[1].Before)
+	assert.Equal(t, "e12345678.orders", events[1].After.Topic)
+
+	// And produced to the topic keyed by system.
+	records := cluster.Records("audit")
+	assert.Len(t, records, 2)
+	assert.Equal(t, "orders.yaml", string(records[0].Key))
+	var produced Event
+	assert.NoError(t, json.Unmarshal(records[1].Value, &produced))
+	assert.Equal(t, EndpointCreate, produced.Action)
+
+	// A failing sink does not stop the others.
+	cluster.Fail(fake.Produce, errors.New("broker unavailable"))
+	assert.Error(t, trail.Record(ctx, "", Event{Action: TopicCreate, Target: "e12345678.orders"}))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"action":"topic.create"`)
+
+	var none *Trail
+	assert.NoError(t, none.Record(ctx, "", Event{Action: TopicCreate}))
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+)
+
+// CloudEventsContentType is the content type of CloudEvents in structured mode.
+const CloudEventsContentType = "application/cloudevents+json; charset=UTF-8"
+
+// DefaultSource is the source of CloudEvents if the sink has none.
+const DefaultSource = "/stargazer-kafka"
+
+// cloudEventTypes are the CloudEvents types of the actions.
+var cloudEventTypes = map[string]string{
+	TopicCreate:     "topic.created",
+	TopicDelete:     "topic.deleted",
+	EndpointCreate:  "endpoint.created",
+	EndpointDelete:  "endpoint.deleted",
+	EndpointUpdate:  "endpoint.updated",
+	ACLCreate:       "acl.created",
+	ACLDelete:       "acl.deleted",
+	SubjectRegister: "subject.registered",
+	SubjectConfig:   "subject.updated",
+	SubjectDelete:   "subject.deleted",
+}
+
+// CloudEvent is a change as a CloudEvent 1.0 in structured mode. Data is the event.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	Id              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Event     `json:"data"`
+}
+
+// CloudEventsSink produces events to a topic as CloudEvents, keyed by the name of the topic changed.
+// The source of the events is Source followed by the system. The topic must exist.
+type CloudEventsSink struct {
+	Producer kafka.Producer
+	Topic    string
+	Source   string
+}
+
+func (s *CloudEventsSink) String() string {
+	return "CloudEvents topic " + s.Topic
+}
+
+func (s *CloudEventsSink) Write(ctx context.Context, events []Event) error {
+
+	source := s.Source
+	if source == "" {
+		source = DefaultSource
+	}
+
+	records := make([]kafka.Record, 0, len(events))
+	for _, event := range events {
+		id, err := newId()
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(CloudEvent{
+			SpecVersion:     "1.0",
+			Id:              id,
+			Source:          source + "/" + event.System,
+			Type:            cloudEventTypes[event.Action],
+			Subject:         event.Target,
+			Time:            event.Time,
+			DataContentType: "application/json",
+			Data:            event,
+		})
+		if err != nil {
+			return err
+		}
+		records = append(records, kafka.Record{
+			Key:     []byte(event.Topic()),
+			Value:   value,
+			Headers: []kafka.Header{{Key: "content-type", Value: []byte(CloudEventsContentType)}},
+		})
+	}
+
+	if err := s.Producer.Produce(ctx, s.Topic, records...); err != nil {
+		return fmt.Errorf("failed to produce to %s. %v", s.Topic, err)
+	}
+	return nil
+}
+
+// Topic returns the name of the topic the event is about: the target of topic events, and the topic of
+// the endpoint, ACL or subject otherwise.
+func (e *Event) Topic() string {
+
+	if e.Action == TopicCreate || e.Action == TopicDelete {
+		return e.Target
+	}
+	for _, state := range []*State{e.After, e.Before} {
+		if state != nil && state.Topic != "" {
+			return state.Topic
+		}
+	}
+	return e.Target
+}
+
+// newId returns a random UUID.
+func newId() (string, error) {
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
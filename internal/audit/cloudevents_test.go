@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudEventsSink(t *testing.T) {
+
+	cluster := fake.New("events")
+	trail := &Trail{System: "orders.yaml", Direction: "starlify_to_kafka", Sinks: []Sink{
+		&CloudEventsSink{Producer: cluster, Topic: "events"},
+	}}
+
+	assert.NoError(t, trail.Record(context.Background(), "e12345678.",
+		Event{Action: TopicCreate, Target: "e12345678.orders", After: &State{Name: "e12345678.orders", Endpoint: "Orders"}},
+		Event{Action: EndpointUpdate, Target: "Orders", After: &State{Name: "Orders", Topic: "e12345678.orders"}},
+		Event{Action: SubjectDelete, Target: "e12345678.stale-value", Before: &State{Name: "e12345678.stale-value", Topic: "e12345678.stale"}},
+	))
+
+	records := cluster.Records("events")
+	assert.Len(t, records, 3)
+	assert.Equal(t, "e12345678.orders", string(records[0].Key))
+	assert.Equal(t, "e12345678.orders", string(records[1].Key))
+	assert.Equal(t, "e12345678.stale", string(records[2].Key))
+	assert.Equal(t, "content-type", records[0].Headers[0].Key)
+	assert.Equal(t, CloudEventsContentType, string(records[0].Headers[0].Value))
+
+	var events []CloudEvent
+	for _, record := range records {
+		var event CloudEvent
+		assert.NoError(t, json.Unmarshal(record.Value, &event))
+		events = append(events, event)
+	}
+	assert.Equal(t, "1.0", events[0].SpecVersion)
+	assert.Equal(t, "topic.created", events[0].Type)
+	assert.Equal(t, DefaultSource+"/orders.yaml", events[0].Source)
+	assert.Equal(t, "e12345678.orders", events[0].Subject)
+	assert.Equal(t, "application/json", events[0].DataContentType)
+	assert.Equal(t, "e12345678.", events[0].Data.Prefix)
+	assert.Equal(t, "Orders", events[0].Data.After.Endpoint)
+	assert.Len(t, events[0].Id, 36)
+	assert.NotEqual(t, events[0].Id, events[1].Id)
+	assert.Equal(t, "endpoint.updated", events[1].Type)
+	assert.Equal(t, "subject.deleted", events[2].Type)
+}
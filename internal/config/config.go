@@ -6,12 +6,16 @@ import (
 	"github.com/spf13/viper"
 	"os"
 	"strings"
+	"time"
 )
 
 // Config is the configuration file struct
 type Config struct {
 	Sync struct {
-		Direction string `json:"direction"`
+		Direction      string `json:"direction"`
+		ConsumerGroups bool   `yaml:"consumerGroups"`
+		// Attributes reports partitions, replication and topic configs on endpoints in kafka_to_starlify. Off by default.
+		Attributes bool `yaml:"attributes"`
 	} `yaml:"sync"`
 
 	Starlify struct {
@@ -19,6 +23,10 @@ type Config struct {
 		ApiKey       string `yaml:"apiKey"`
 		AgentId      string `yaml:"agentId"`
 		MiddlewareId string `yaml:"middlewareId"`
+		// RateLimit is requests per second, shared by all systems using the same baseUrl and apiKey.
+		RateLimit     float64 `yaml:"rateLimit"`
+		Burst         int     `yaml:"burst"`
+		MaxConcurrent int     `yaml:"maxConcurrent"`
 	} `yaml:"starlify"`
 
 	Kafka struct {
@@ -36,19 +44,139 @@ type Config struct {
 				Password string `yaml:"password"`
 			} `yaml:"plain"`
 		} `yaml:"auth"`
+		Metadata struct {
+			NamesOnly bool `yaml:"namesOnly"`
+		} `yaml:"metadata"`
 	} `yaml:"kafka"`
+
+	// SchemaRegistry publishes the schemas of topics on endpoints in kafka_to_starlify, if url is set.
+	SchemaRegistry struct {
+		URL      string `yaml:"url"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		TLS      struct {
+			CAFile             string `yaml:"caFile"`
+			CertFile           string `yaml:"certFile"`
+			KeyFile            string `yaml:"keyFile"`
+			InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+		} `yaml:"tls"`
+		// Strategy is topic_name or topic_record_name, Subjects are templates like {topic}-value used instead.
+		Strategy      string   `yaml:"strategy"`
+		Subjects      []string `yaml:"subjects"`
+		IncludeSchema bool     `yaml:"includeSchema"`
+		// Lifecycle registers and deletes subjects with the topics in starlify_to_kafka.
+		Lifecycle struct {
+			Enabled         bool   `yaml:"enabled"`
+			DryRun          bool   `yaml:"dryRun"`
+			SchemaAttribute string `yaml:"schemaAttribute"`
+			Compatibility   string `yaml:"compatibility"`
+		} `yaml:"lifecycle"`
+	} `yaml:"schemaRegistry"`
+
+	// Sampling reads the latest records of topics without schemas in kafka_to_starlify, to report their payload
+	// format on endpoints. Records are read without a consumer group, so no offsets are committed.
+	Sampling struct {
+		Enabled   bool          `yaml:"enabled"`
+		Records   int           `yaml:"records"`
+		Interval  time.Duration `yaml:"interval"`
+		Timeout   time.Duration `yaml:"timeout"`
+		MaxTopics int           `yaml:"maxTopics"`
+	} `yaml:"sampling"`
+
+	// Audit records every change the agent makes in a JSON-lines file and/or a topic of the cluster, see audit.Event.
+	Audit struct {
+		File  string `yaml:"file"`
+		Topic string `yaml:"topic"`
+	} `yaml:"audit"`
+
+	// CloudEvents produces every change the agent makes as a CloudEvent to a topic of the cluster.
+	CloudEvents struct {
+		Topic  string `yaml:"topic"`
+		Source string `yaml:"source"`
+	} `yaml:"cloudEvents"`
+
+	// Webhooks notified of created and deleted topics and endpoints, skipped deletes and health changes.
+	Webhooks struct {
+		Hooks []struct {
+			URL string `yaml:"url"`
+			// Format is json, slack or teams.
+			Format  string            `yaml:"format"`
+			Events  []string          `yaml:"events"`
+			Headers map[string]string `yaml:"headers"`
+		} `yaml:"hooks"`
+		Retries    int           `yaml:"retries"`
+		Backoff    time.Duration `yaml:"backoff"`
+		DeadLetter string        `yaml:"deadLetter"`
+	} `yaml:"webhooks"`
+
+	// Prefix policy for the Kafka prefix of the middleware, see prefix.Policy.
+	Prefix struct {
+		Pattern    string `yaml:"pattern"`
+		Separators string `yaml:"separators"`
+		MinLength  int    `yaml:"minLength"`
+		MaxLength  int    `yaml:"maxLength"`
+		// Topics are the only topics managed, instead of the topics under the prefix.
+		Topics []string `yaml:"topics"`
+	} `yaml:"prefix"`
+
+	// Discovery of prefixes in the cluster that no system manages.
+	Discovery struct {
+		// Report the unmanaged prefixes in the details of the Starlify agent.
+		Report bool `yaml:"report"`
+	} `yaml:"discovery"`
+
+	// Orphans is what to do with topics without a prefix, see stargazerkafka.OrphanPolicy.
+	// Systems on the same cluster should have the same orphans.
+	Orphans struct {
+		Unprefixed     string   `yaml:"unprefixed"`
+		Internal       string   `yaml:"internal"`
+		InternalTopics []string `yaml:"internalTopics"`
+		MiddlewareId   string   `yaml:"middlewareId"`
+	} `yaml:"orphans"`
+
+	// Mapping of endpoint names to topic names, see mapping.Rules.
+	Mapping struct {
+		AddPrefix bool   `yaml:"addPrefix"`
+		Case      string `yaml:"case"`
+		Replace   []struct {
+			From string `yaml:"from"`
+			To   string `yaml:"to"`
+		} `yaml:"replace"`
+		Template  string            `yaml:"template"`
+		Variables map[string]string `yaml:"variables"`
+	} `yaml:"mapping"`
+
+	Metrics struct {
+		ConsumerLag bool `yaml:"consumerLag"`
+		Throughput  bool `yaml:"throughput"`
+	} `yaml:"metrics"`
+
+	ACL struct {
+		Enabled    bool   `yaml:"enabled"`
+		Host       string `yaml:"host"`
+		Principals []struct {
+			System      string `yaml:"system"`
+			Principal   string `yaml:"principal"`
+			GroupPrefix string `yaml:"groupPrefix"`
+		} `yaml:"principals"`
+	} `yaml:"acl"`
 }
 
 // LoadConfig will load properties from YAML configuration file or environment variables
 func LoadConfig(configFile string) (*Config, error) {
 
 	viper.SetDefault("sync.direction", "starlify_to_kafka")
+	viper.SetDefault("sync.consumerGroups", false)
+	viper.SetDefault("sync.attributes", false)
 
 	// Default Starlify properties
 	viper.SetDefault("starlify.baseUrl", "https://api.starlify.com/hypermedia")
 	viper.SetDefault("starlify.apiKey", "")
 	viper.SetDefault("starlify.middlewareId", "")
 	viper.SetDefault("starlify.agentId", "")
+	viper.SetDefault("starlify.rateLimit", 10.0)
+	viper.SetDefault("starlify.burst", 20)
+	viper.SetDefault("starlify.maxConcurrent", 4)
 
 	// Default Kafka properties
 	viper.SetDefault("kafka.bootstrapServers", []string{"127.0.0.1:9092"})
@@ -57,6 +185,65 @@ func LoadConfig(configFile string) (*Config, error) {
 	viper.SetDefault("kafka.auth.plain.password", "")
 	viper.SetDefault("kafka.auth.iam.secret", "")
 	viper.SetDefault("kafka.auth.iam.key", "")
+	viper.SetDefault("kafka.metadata.namesOnly", false)
+
+	// Default Schema Registry properties
+	viper.SetDefault("schemaRegistry.url", "")
+	viper.SetDefault("schemaRegistry.username", "")
+	viper.SetDefault("schemaRegistry.password", "")
+	viper.SetDefault("schemaRegistry.strategy", "topic_name")
+	viper.SetDefault("schemaRegistry.includeSchema", true)
+	viper.SetDefault("schemaRegistry.lifecycle.enabled", false)
+	viper.SetDefault("schemaRegistry.lifecycle.dryRun", false)
+	viper.SetDefault("schemaRegistry.lifecycle.schemaAttribute", "value.schema")
+	viper.SetDefault("schemaRegistry.lifecycle.compatibility", "")
+
+	// Default sampling properties
+	viper.SetDefault("sampling.enabled", false)
+	viper.SetDefault("sampling.records", 20)
+	viper.SetDefault("sampling.interval", time.Hour)
+	viper.SetDefault("sampling.timeout", 5*time.Second)
+	viper.SetDefault("sampling.maxTopics", 50)
+
+	// Default audit properties
+	viper.SetDefault("audit.file", "")
+	viper.SetDefault("audit.topic", "")
+
+	// Default CloudEvents properties
+	viper.SetDefault("cloudEvents.topic", "")
+	viper.SetDefault("cloudEvents.source", "/stargazer-kafka")
+
+	// Default webhook properties
+	viper.SetDefault("webhooks.retries", 3)
+	viper.SetDefault("webhooks.backoff", 2*time.Second)
+	viper.SetDefault("webhooks.deadLetter", "")
+
+	// Default prefix properties, the Starlify prefix e.g. e85da0fd6.
+	viper.SetDefault("prefix.pattern", "^e")
+	viper.SetDefault("prefix.separators", ".")
+	viper.SetDefault("prefix.minLength", 10)
+	viper.SetDefault("prefix.maxLength", 10)
+
+	// Default discovery properties
+	viper.SetDefault("discovery.report", false)
+
+	// Default orphan properties
+	viper.SetDefault("orphans.unprefixed", "ignore")
+	viper.SetDefault("orphans.internal", "ignore")
+	viper.SetDefault("orphans.middlewareId", "")
+
+	// Default mapping properties
+	viper.SetDefault("mapping.addPrefix", false)
+	viper.SetDefault("mapping.case", "")
+	viper.SetDefault("mapping.template", "")
+
+	// Default metrics properties
+	viper.SetDefault("metrics.consumerLag", false)
+	viper.SetDefault("metrics.throughput", false)
+
+	// Default ACL properties
+	viper.SetDefault("acl.enabled", false)
+	viper.SetDefault("acl.host", "*")
 
 	// Override properties with upper case environment variable of property name with . replaced with _
 	viper.AutomaticEnv()
@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// ACL is a single rule for a principal on a topic or consumer group. The agent only creates ALLOW rules.
+type ACL struct {
+	Principal  string
+	Host       string
+	Resource   kmsg.ACLResourceType
+	Name       string
+	Pattern    kadm.ACLPattern
+	Operation  kadm.ACLOperation
+	Permission kmsg.ACLPermissionType
+}
+
+// Key uniquely identifies the ACL.
+func (a ACL) Key() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s", a.Principal, a.Host, a.Resource, a.Name, a.Pattern, a.Operation, a.Permission)
+}
+
+func (a ACL) builder() *kadm.ACLBuilder {
+
+	b := kadm.NewACLs().
+		Allow(a.Principal).
+		AllowHosts(a.Host).
+		Operations(a.Operation).
+		ResourcePatternType(a.Pattern)
+
+	if a.Resource == kmsg.ACLResourceTypeGroup {
+		return b.Groups(a.Name)
+	}
+	return b.Topics(a.Name)
+}
+
+// GetACLs returns all READ and WRITE allow rules on topics and groups for the given principals.
+func (c *Client) GetACLs(ctx context.Context, principals ...string) ([]ACL, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if len(principals) == 0 {
+		return nil, nil
+	}
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer adminClient.Close()
+
+	filter := kadm.NewACLs().
+		Topics().
+		Groups().
+		Allow(principals...).
+		AllowHosts().
+		Operations(kadm.OpRead, kadm.OpWrite).
+		ResourcePatternType(kadm.ACLPatternAny)
+
+	results, err := adminClient.DescribeACLs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var acls []ACL
+	for _, result := range results {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		for _, d := range result.Described {
+			if d.Permission != kmsg.ACLPermissionTypeAllow {
+				continue
+			}
+			acls = append(acls, ACL{
+				Principal:  d.Principal,
+				Host:       d.Host,
+				Resource:   d.Type,
+				Name:       d.Name,
+				Pattern:    d.Pattern,
+				Operation:  d.Operation,
+				Permission: d.Permission,
+			})
+		}
+	}
+	return acls, nil
+}
+
+// CreateACLs creates the given allow rules.
+func (c *Client) CreateACLs(ctx context.Context, acls ...ACL) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if len(acls) == 0 {
+		return nil
+	}
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return err
+	}
+	defer adminClient.Close()
+
+	for _, acl := range acls {
+		results, err := adminClient.CreateACLs(ctx, acl.builder())
+		if err != nil {
+			return fmt.Errorf("failed to create ACL %s. %v", acl.Key(), err)
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				return fmt.Errorf("failed to create ACL %s. %v", acl.Key(), result.Err)
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteACLs deletes the given allow rules.
+func (c *Client) DeleteACLs(ctx context.Context, acls ...ACL) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if len(acls) == 0 {
+		return nil
+	}
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return err
+	}
+	defer adminClient.Close()
+
+	for _, acl := range acls {
+		results, err := adminClient.DeleteACLs(ctx, acl.builder())
+		if err != nil {
+			return fmt.Errorf("failed to delete ACL %s. %v", acl.Key(), err)
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				return fmt.Errorf("failed to delete ACL %s. %v", acl.Key(), result.Err)
+			}
+		}
+	}
+	return nil
+}
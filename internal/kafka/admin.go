@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// Admin is what the sync needs from a Kafka cluster. Client implements it with franz-go,
+// fake.Cluster in memory.
+type Admin interface {
+	Ping(ctx context.Context) error
+
+	GetTopics(ctx context.Context) (kadm.TopicDetails, error)
+	GetTopicNames(ctx context.Context, prefix string) ([]string, error)
+	GetTopicConfigs(ctx context.Context, topics ...string) (map[string]map[string]string, error)
+	CreateTopics(ctx context.Context, topics ...string) (TopicResults, error)
+	DeleteTopics(ctx context.Context, topics ...string) (TopicResults, error)
+
+	GetConsumerGroups(ctx context.Context, prefix string) ([]ConsumerGroup, error)
+	GetEndOffsets(ctx context.Context, topics ...string) (map[string]map[int32]int64, error)
+	SampleRecords(ctx context.Context, topic string, n int) ([]Record, error)
+
+	GetACLs(ctx context.Context, principals ...string) ([]ACL, error)
+	CreateACLs(ctx context.Context, acls ...ACL) error
+	DeleteACLs(ctx context.Context, acls ...ACL) error
+}
+
+var _ Admin = (*Client)(nil)
+
+// TopicResults are the errors of the topics of a create or delete request, by topic, nil for the topics
+// the cluster created or deleted.
+type TopicResults map[string]error
+
+// Succeeded returns the sorted topics without an error.
+func (r TopicResults) Succeeded() []string {
+
+	var topics []string
+	for topic, err := range r {
+		if err == nil {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Err returns an error with the topics that failed, nil if none did.
+func (r TopicResults) Err() error {
+
+	var failed []string
+	for topic, err := range r {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", topic, err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return errors.New(strings.Join(failed, "; "))
+}
+
+// GetTopicConfigs returns the configs with a value of each topic, by topic and config name.
+// Topics whose configs could not be described are left out.
+func (c *Client) GetTopicConfigs(ctx context.Context, topics ...string) (map[string]map[string]string, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer adminClient.Close()
+
+	described, err := adminClient.DescribeTopicConfigs(ctx, topics...)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string]map[string]string)
+	for _, resource := range described {
+		if resource.Err != nil {
+			log.Logger.Debugf("Failed to describe configs of %s: %v", resource.Name, resource.Err)
+			continue
+		}
+		configs[resource.Name] = make(map[string]string)
+		for _, config := range resource.Configs {
+			if config.Value != nil {
+				configs[resource.Name][config.Key] = *config.Value
+			}
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// snapshot is the topic metadata of one cluster as seen during the current sync cycle.
+type snapshot struct {
+	topics kadm.TopicDetails
+	names  []string
+}
+
+// entry holds the snapshot of one cluster and identity, or the consumer groups of one prefix. Its lock is held
+// while they are fetched, so systems with the same key share one request while other keys are fetched in parallel.
+type entry struct {
+	sync.Mutex
+	snapshot *snapshot
+	groups   *[]ConsumerGroup
+}
+
+// metadataCache shares topic metadata between all systems pointing at the same cluster as the same identity,
+// since the topics listed depend on the ACLs of the identity.
+// Entries live until ResetMetadata is called at the start of the next cycle, or until
+// the agent itself creates or deletes topics in the cluster.
+var metadataCache = struct {
+	sync.Mutex
+	entries map[string]*entry
+}{
+	entries: make(map[string]*entry),
+}
+
+// ResetMetadata drops all cached cluster metadata and consumer groups. Call once per sync cycle.
+func ResetMetadata() {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+
+	metadataCache.entries = make(map[string]*entry)
+}
+
+// ClusterKey identifies a cluster by its (sorted) bootstrap servers.
+func (c *Client) ClusterKey() string {
+	hosts := append([]string(nil), c.Hosts...)
+	sort.Strings(hosts)
+	return strings.Join(hosts, ",")
+}
+
+// metadataKey identifies the metadata of the cluster as seen by the identity of the client.
+func (c *Client) metadataKey() string {
+	return c.ClusterKey() + "|" + c.Identity
+}
+
+// groupsKey identifies the consumer groups of prefix as seen by the identity of the client.
+func (c *Client) groupsKey(prefix string) string {
+	return c.metadataKey() + "|groups|" + prefix
+}
+
+func (c *Client) invalidateMetadata() {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+
+	// Every identity sees the created or deleted topics.
+	prefix := c.ClusterKey() + "|"
+	for key := range metadataCache.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(metadataCache.entries, key)
+		}
+	}
+}
+
+// cacheEntry returns the entry of key, adding it if it is missing.
+func cacheEntry(key string) *entry {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+
+	e, ok := metadataCache.entries[key]
+	if !ok {
+		e = &entry{}
+		metadataCache.entries[key] = e
+	}
+	return e
+}
+
+// metadata returns the cached snapshot of the cluster, fetching it if it is missing. A snapshot
+// fetched without partition details is replaced when details are requested.
+func (c *Client) metadata(ctx context.Context, details bool) (*snapshot, error) {
+
+	key := c.metadataKey()
+	e := cacheEntry(key)
+	e.Lock()
+	defer e.Unlock()
+
+	if s := e.snapshot; s != nil && (s.topics != nil || !details) {
+		log.Logger.Debugf("Using cached metadata for %s", c.ClusterKey())
+		return s, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "kafka metadata",
+		attribute.String("kafka.cluster", c.ClusterKey()),
+		attribute.Bool("kafka.details", details),
+	)
+
+	var s *snapshot
+	if details {
+		topics, err := fetchTopics(ctx, c)
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+		s = &snapshot{topics: topics, names: topics.Names()}
+	} else {
+		names, err := fetchTopicNames(ctx, c)
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+		s = &snapshot{names: names}
+	}
+	sort.Strings(s.names)
+	tracing.End(span, nil)
+
+	e.snapshot = s
+	return s, nil
+}
+
+// filterNames returns the names starting with prefix.
+func filterNames(names []string, prefix string) []string {
+
+	var filtered []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
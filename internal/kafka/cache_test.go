@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func TestTopicNamesUsesSharedSnapshot(t *testing.T) {
+	defer ResetMetadata()
+
+	a := NewKafkaClient(WithBootstrapServers("b:9092", "a:9092"), WithNamesOnly(true))
+	b := NewKafkaClient(WithBootstrapServers("a:9092", "b:9092"), WithNamesOnly(true))
+
+	assert.Equal(t, a.ClusterKey(), b.ClusterKey())
+
+	cacheEntry(a.metadataKey()).snapshot = &snapshot{
+		names: []string{"e12345678.a", "e12345678.b", "e87654321.a"},
+	}
+
+	names, err := b.GetTopicNames(context.Background(), "e12345678.")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e12345678.a", "e12345678.b"}, names)
+}
+
+func TestSnapshotPerIdentity(t *testing.T) {
+	defer ResetMetadata()
+
+	a := NewKafkaClient(WithBootstrapServers("a:9092"), WithPassword("orders", "secret"), WithNamesOnly(true))
+	b := NewKafkaClient(WithBootstrapServers("a:9092"), WithPassword("payments", "secret"), WithNamesOnly(true))
+	c := NewKafkaClient(WithBootstrapServers("a:9092"), WithOAuth("token"))
+
+	assert.Equal(t, a.ClusterKey(), b.ClusterKey())
+	assert.NotEqual(t, a.metadataKey(), b.metadataKey())
+	assert.NotEqual(t, a.metadataKey(), c.metadataKey())
+	assert.NotContains(t, c.metadataKey(), "token")
+
+	cacheEntry(a.metadataKey()).snapshot = &snapshot{names: []string{"e12345678.orders"}}
+	cacheEntry(b.metadataKey()).snapshot = &snapshot{names: []string{"e12345678.payments"}}
+
+	names, err := b.GetTopicNames(context.Background(), "e12345678.")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e12345678.payments"}, names)
+
+	// Topics created by one identity are fetched again by all.
+	a.invalidateMetadata()
+	assert.Empty(t, metadataCache.entries)
+}
+
+func TestCreateAndDeleteInvalidateSnapshot(t *testing.T) {
+	defer ResetMetadata()
+
+	c := NewKafkaClient(WithBootstrapServers("a:9092"))
+	cacheEntry(c.metadataKey()).snapshot = &snapshot{
+		topics: kadm.TopicDetails{"e12345678.a": {Topic: "e12345678.a"}},
+		names:  []string{"e12345678.a"},
+	}
+
+	topics, err := c.GetTopics(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, topics, 1)
+
+	c.invalidateMetadata()
+	_, ok := metadataCache.entries[c.metadataKey()]
+	assert.False(t, ok)
+}
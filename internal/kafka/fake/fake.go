@@ -0,0 +1,450 @@
+// Package fake is an in-memory Kafka cluster implementing kafka.Admin.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// Operations that can be made to fail with Fail.
+const (
+	Ping              = "Ping"
+	GetTopics         = "GetTopics"
+	GetTopicNames     = "GetTopicNames"
+	GetTopicConfigs   = "GetTopicConfigs"
+	CreateTopics      = "CreateTopics"
+	DeleteTopics      = "DeleteTopics"
+	GetConsumerGroups = "GetConsumerGroups"
+	GetEndOffsets     = "GetEndOffsets"
+	SampleRecords     = "SampleRecords"
+	Produce           = "Produce"
+	GetACLs           = "GetACLs"
+	CreateACLs        = "CreateACLs"
+	DeleteACLs        = "DeleteACLs"
+)
+
+// Topic is a topic of the fake cluster.
+type Topic struct {
+	Partitions        int32
+	ReplicationFactor int16
+	Internal          bool
+	Configs           map[string]string
+	// EndOffsets are the end offsets per partition.
+	EndOffsets map[int32]int64
+	// Records are the records of the topic, oldest first.
+	Records []kafka.Record
+}
+
+// Cluster is an in-memory Kafka cluster. All methods are safe for concurrent use.
+type Cluster struct {
+	mu       sync.Mutex
+	topics   map[string]*Topic
+	groups   map[string]kafka.ConsumerGroup
+	acls     map[string]kafka.ACL
+	failures map[string]error
+	refused  map[string]error
+	calls    map[string]int
+}
+
+var (
+	_ kafka.Admin    = (*Cluster)(nil)
+	_ kafka.Producer = (*Cluster)(nil)
+)
+
+// New returns a cluster with the topics, each with one partition.
+func New(topics ...string) *Cluster {
+
+	c := &Cluster{
+		topics:   make(map[string]*Topic),
+		groups:   make(map[string]kafka.ConsumerGroup),
+		acls:     make(map[string]kafka.ACL),
+		failures: make(map[string]error),
+		refused:  make(map[string]error),
+		calls:    make(map[string]int),
+	}
+	for _, topic := range topics {
+		c.AddTopic(topic, Topic{})
+	}
+	return c
+}
+
+// AddTopic adds or replaces a topic. Missing partitions and replication factor default to 1.
+func (c *Cluster) AddTopic(name string, topic Topic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if topic.Partitions <= 0 {
+		topic.Partitions = 1
+	}
+	if topic.ReplicationFactor <= 0 {
+		topic.ReplicationFactor = 1
+	}
+	if topic.Configs == nil {
+		topic.Configs = make(map[string]string)
+	}
+	c.topics[name] = &topic
+}
+
+// AddConsumerGroup adds or replaces a consumer group.
+func (c *Cluster) AddConsumerGroup(group kafka.ConsumerGroup) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.groups[group.Group] = group
+}
+
+// Fail makes every later call of operation fail with err, until called again with a nil err.
+func (c *Cluster) Fail(operation string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		delete(c.failures, operation)
+		return
+	}
+	c.failures[operation] = err
+}
+
+// Refuse makes the cluster refuse to create or delete the topics with err in later calls of operation,
+// CreateTopics or DeleteTopics, while the other topics of the call succeed. A nil err accepts them again.
+func (c *Cluster) Refuse(operation string, err error, topics ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, topic := range topics {
+		if err == nil {
+			delete(c.refused, operation+"|"+topic)
+			continue
+		}
+		c.refused[operation+"|"+topic] = err
+	}
+}
+
+// Calls returns the number of calls of operation.
+func (c *Cluster) Calls(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.calls[operation]
+}
+
+// Topics returns the sorted names of all topics.
+func (c *Cluster) Topics() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.names("")
+}
+
+// Records returns the records of the topic, oldest first.
+func (c *Cluster) Records(topic string) []kafka.Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.topics[topic]; ok {
+		return append([]kafka.Record(nil), t.Records...)
+	}
+	return nil
+}
+
+// ACLs returns all ACLs, sorted by key.
+func (c *Cluster) ACLs() []kafka.ACL {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var acls []kafka.ACL
+	for _, acl := range c.acls {
+		acls = append(acls, acl)
+	}
+	sort.Slice(acls, func(i, j int) bool {
+		return acls[i].Key() < acls[j].Key()
+	})
+	return acls
+}
+
+func (c *Cluster) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.call(Ping)
+}
+
+func (c *Cluster) GetTopics(ctx context.Context) (kadm.TopicDetails, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(GetTopics); err != nil {
+		return nil, err
+	}
+
+	details := make(kadm.TopicDetails)
+	for name, topic := range c.topics {
+		partitions := make(kadm.PartitionDetails)
+		for p := int32(0); p < topic.Partitions; p++ {
+			var replicas []int32
+			for r := int32(0); r < int32(topic.ReplicationFactor); r++ {
+				replicas = append(replicas, r)
+			}
+			partitions[p] = kadm.PartitionDetail{Topic: name, Partition: p, Leader: 0, Replicas: replicas, ISR: replicas}
+		}
+		details[name] = kadm.TopicDetail{Topic: name, IsInternal: topic.Internal, Partitions: partitions}
+	}
+	return details, nil
+}
+
+func (c *Cluster) GetTopicNames(ctx context.Context, prefix string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(GetTopicNames); err != nil {
+		return nil, err
+	}
+	return c.names(prefix), nil
+}
+
+func (c *Cluster) GetTopicConfigs(ctx context.Context, topics ...string) (map[string]map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(GetTopicConfigs); err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string]map[string]string)
+	for _, name := range topics {
+		if topic, ok := c.topics[name]; ok {
+			configs[name] = make(map[string]string)
+			for k, v := range topic.Configs {
+				configs[name][k] = v
+			}
+		}
+	}
+	return configs, nil
+}
+
+func (c *Cluster) CreateTopics(ctx context.Context, topics ...string) (kafka.TopicResults, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like Client, nothing is sent to the cluster for nothing to do.
+	if len(topics) == 0 {
+		return nil, nil
+	}
+	if err := c.call(CreateTopics); err != nil {
+		return nil, err
+	}
+	results := make(kafka.TopicResults)
+	for _, name := range topics {
+		if err, ok := c.refused[CreateTopics+"|"+name]; ok {
+			results[name] = err
+			continue
+		}
+		if _, ok := c.topics[name]; ok {
+			results[name] = fmt.Errorf("topic %s already exists", name)
+			continue
+		}
+		c.topics[name] = &Topic{Partitions: 1, ReplicationFactor: 1, Configs: make(map[string]string)}
+		results[name] = nil
+	}
+	return results, nil
+}
+
+func (c *Cluster) DeleteTopics(ctx context.Context, topics ...string) (kafka.TopicResults, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like Client, nothing is sent to the cluster for nothing to do.
+	if len(topics) == 0 {
+		return nil, nil
+	}
+	if err := c.call(DeleteTopics); err != nil {
+		return nil, err
+	}
+	results := make(kafka.TopicResults)
+	for _, name := range topics {
+		if err, ok := c.refused[DeleteTopics+"|"+name]; ok {
+			results[name] = err
+			continue
+		}
+		if _, ok := c.topics[name]; !ok {
+			results[name] = fmt.Errorf("topic %s does not exist", name)
+			continue
+		}
+		delete(c.topics, name)
+		results[name] = nil
+	}
+	return results, nil
+}
+
+func (c *Cluster) GetConsumerGroups(ctx context.Context, prefix string) ([]kafka.ConsumerGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(GetConsumerGroups); err != nil {
+		return nil, err
+	}
+
+	var groups []kafka.ConsumerGroup
+	for _, g := range c.groups {
+		group := kafka.ConsumerGroup{Group: g.Group, State: g.State, Offsets: make(map[string]map[int32]int64)}
+		for topic, offsets := range g.Offsets {
+			if strings.HasPrefix(topic, prefix) {
+				group.Offsets[topic] = offsets
+			}
+		}
+		if len(group.Offsets) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Group < groups[j].Group
+	})
+	return groups, nil
+}
+
+func (c *Cluster) GetEndOffsets(ctx context.Context, topics ...string) (map[string]map[int32]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(GetEndOffsets); err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[string]map[int32]int64)
+	for _, name := range topics {
+		topic, ok := c.topics[name]
+		if !ok {
+			continue
+		}
+		offsets[name] = make(map[int32]int64)
+		for p := int32(0); p < topic.Partitions; p++ {
+			offsets[name][p] = topic.EndOffsets[p]
+		}
+	}
+	return offsets, nil
+}
+
+func (c *Cluster) SampleRecords(ctx context.Context, topic string, n int) ([]kafka.Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(SampleRecords); err != nil {
+		return nil, err
+	}
+
+	t, ok := c.topics[topic]
+	if !ok || n <= 0 {
+		return nil, nil
+	}
+	records := t.Records
+	if len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return append([]kafka.Record(nil), records...), nil
+}
+
+// Produce appends the records to the topic, which must exist, numbering them from the end of its partition 0.
+func (c *Cluster) Produce(ctx context.Context, topic string, records ...kafka.Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(Produce); err != nil {
+		return err
+	}
+
+	t, ok := c.topics[topic]
+	if !ok {
+		return fmt.Errorf("unknown topic %s", topic)
+	}
+	if t.EndOffsets == nil {
+		t.EndOffsets = make(map[int32]int64)
+	}
+	for _, record := range records {
+		record.Partition = 0
+		record.Offset = t.EndOffsets[0]
+		t.EndOffsets[0]++
+		t.Records = append(t.Records, record)
+	}
+	return nil
+}
+
+func (c *Cluster) GetACLs(ctx context.Context, principals ...string) ([]kafka.ACL, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.call(GetACLs); err != nil {
+		return nil, err
+	}
+
+	var acls []kafka.ACL
+	for _, acl := range c.acls {
+		for _, principal := range principals {
+			if acl.Principal == principal {
+				acls = append(acls, acl)
+			}
+		}
+	}
+	return acls, nil
+}
+
+func (c *Cluster) CreateACLs(ctx context.Context, acls ...kafka.ACL) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like Client, nothing is sent to the cluster for nothing to do.
+	if len(acls) == 0 {
+		return nil
+	}
+	if err := c.call(CreateACLs); err != nil {
+		return err
+	}
+	for _, acl := range acls {
+		c.acls[acl.Key()] = acl
+	}
+	return nil
+}
+
+func (c *Cluster) DeleteACLs(ctx context.Context, acls ...kafka.ACL) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like Client, nothing is sent to the cluster for nothing to do.
+	if len(acls) == 0 {
+		return nil
+	}
+	if err := c.call(DeleteACLs); err != nil {
+		return err
+	}
+	for _, acl := range acls {
+		delete(c.acls, acl.Key())
+	}
+	return nil
+}
+
+// call counts a call of operation and returns its failure, if any.
+func (c *Cluster) call(operation string) error {
+
+	c.calls[operation]++
+	if err, ok := c.failures[operation]; ok {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	return nil
+}
+
+func (c *Cluster) names(prefix string) []string {
+
+	var names []string
+	for name := range c.topics {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
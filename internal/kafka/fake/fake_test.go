@@ -0,0 +1,27 @@
+package fake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/entiros/stargazer-kafka/internal/prefix"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixes(t *testing.T) {
+
+	c := New("e12345678.orders", "e12345678.payments", "e87654321.orders", "orders", "__consumer_offsets", "team-a.orders")
+
+	prefixes, err := kafka.Prefixes(context.Background(), c, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e12345678.", "e87654321."}, prefixes)
+
+	prefixes, err = kafka.Prefixes(context.Background(), c, &prefix.Policy{Pattern: "^team-", Separators: "."})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a."}, prefixes)
+
+	prefixes, err = kafka.Prefixes(context.Background(), c, &prefix.Policy{Topics: []string{"orders"}})
+	assert.NoError(t, err)
+	assert.Empty(t, prefixes)
+}
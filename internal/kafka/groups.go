@@ -0,0 +1,207 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// ConsumerGroup is a consumer group reading from topics under a prefix.
+type ConsumerGroup struct {
+	Group string
+	State string
+	// Offsets are the committed offsets per topic and partition.
+	Offsets map[string]map[int32]int64
+}
+
+// Topics returns the sorted names of the topics the group consumes.
+func (g ConsumerGroup) Topics() []string {
+
+	var topics []string
+	for topic := range g.Offsets {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// GetConsumerGroups returns all consumer groups that are assigned to, or have committed offsets for,
+// topics starting with prefix. Groups without such topics are left out. The groups are cached until
+// ResetMetadata is called, so the consumers and the lag of a system share one lookup per cycle.
+func (c *Client) GetConsumerGroups(ctx context.Context, prefix string) ([]ConsumerGroup, error) {
+
+	e := cacheEntry(c.groupsKey(prefix))
+	e.Lock()
+	defer e.Unlock()
+
+	if e.groups != nil {
+		log.Logger.Debugf("Using cached consumer groups for %s", c.ClusterKey())
+		return *e.groups, nil
+	}
+
+	groups, err := c.fetchConsumerGroups(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	e.groups = &groups
+	return groups, nil
+}
+
+func (c *Client) fetchConsumerGroups(ctx context.Context, prefix string) ([]ConsumerGroup, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer adminClient.Close()
+
+	listed, err := adminClient.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var consumers []string
+	for _, l := range listed.Sorted() {
+		if l.ProtocolType == "" || l.ProtocolType == "consumer" {
+			consumers = append(consumers, l.Group)
+		}
+	}
+	if len(consumers) == 0 {
+		return nil, nil
+	}
+
+	fetched := adminClient.FetchManyOffsets(ctx, consumers...)
+
+	candidates := describable(listed, fetched, prefix)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	described, err := adminClient.DescribeGroups(ctx, candidates...)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []ConsumerGroup
+	for _, d := range described.Sorted() {
+		if d.Err != nil {
+			log.Logger.Debugf("Failed to describe group %s: %v", d.Group, d.Err)
+			continue
+		}
+		if d.ProtocolType != "" && d.ProtocolType != "consumer" {
+			continue
+		}
+
+		group := ConsumerGroup{
+			Group:   d.Group,
+			State:   d.State,
+			Offsets: make(map[string]map[int32]int64),
+		}
+
+		// Assigned but not yet committed partitions count as consumed.
+		for topic, partitions := range d.AssignedPartitions() {
+			if !strings.HasPrefix(topic, prefix) {
+				continue
+			}
+			if _, ok := group.Offsets[topic]; !ok {
+				group.Offsets[topic] = make(map[int32]int64)
+			}
+			for partition := range partitions {
+				group.Offsets[topic][partition] = -1
+			}
+		}
+
+		if f, ok := fetched[d.Group]; ok && f.Err == nil {
+			for topic, partitions := range f.Fetched {
+				if !strings.HasPrefix(topic, prefix) {
+					continue
+				}
+				if _, ok := group.Offsets[topic]; !ok {
+					group.Offsets[topic] = make(map[int32]int64)
+				}
+				for partition, offset := range partitions {
+					if offset.Err == nil {
+						group.Offsets[topic][partition] = offset.At
+					}
+				}
+			}
+		} else if ok {
+			log.Logger.Debugf("Failed to fetch offsets for group %s: %v", d.Group, f.Err)
+		}
+
+		if len(group.Offsets) > 0 {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+// describable returns the sorted consumer groups worth describing for prefix: those with committed offsets
+// for topics starting with prefix, and those with members, whose assignments are only known once described.
+// Empty and dead groups without offsets under prefix can not consume its topics.
+func describable(listed kadm.ListedGroups, fetched kadm.FetchOffsetsResponses, prefix string) []string {
+
+	var groups []string
+	for _, l := range listed.Sorted() {
+		if l.ProtocolType != "" && l.ProtocolType != "consumer" {
+			continue
+		}
+		if l.State != "Empty" && l.State != "Dead" {
+			groups = append(groups, l.Group)
+			continue
+		}
+		if f, ok := fetched[l.Group]; ok && f.Err == nil {
+			for topic := range f.Fetched {
+				if strings.HasPrefix(topic, prefix) {
+					groups = append(groups, l.Group)
+					break
+				}
+			}
+		}
+	}
+	return groups
+}
+
+// GetEndOffsets returns the end (high watermark) offset per topic and partition.
+func (c *Client) GetEndOffsets(ctx context.Context, topics ...string) (map[string]map[int32]int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer adminClient.Close()
+
+	listed, err := adminClient.ListEndOffsets(ctx, topics...)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[string]map[int32]int64)
+	for topic, partitions := range listed {
+		offsets[topic] = make(map[int32]int64)
+		for partition, offset := range partitions {
+			if offset.Err != nil {
+				log.Logger.Debugf("Failed to list end offset for %s/%d: %v", topic, partition, offset.Err)
+				continue
+			}
+			offsets[topic][partition] = offset.Offset
+		}
+	}
+	return offsets, nil
+}
@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func TestDescribableGroupsOfPrefix(t *testing.T) {
+
+	listed := kadm.ListedGroups{
+		"orders":   {Group: "orders", ProtocolType: "consumer", State: "Empty"},
+		"payments": {Group: "payments", ProtocolType: "consumer", State: "Empty"},
+		"failed":   {Group: "failed", ProtocolType: "consumer", State: "Empty"},
+		"active":   {Group: "active", ProtocolType: "consumer", State: "Stable"},
+		"legacy":   {Group: "legacy"},
+		"connect":  {Group: "connect", ProtocolType: "connect", State: "Stable"},
+	}
+	fetched := kadm.FetchOffsetsResponses{
+		"orders":   {Group: "orders", Fetched: kadm.OffsetResponses{"e12345678.orders": {0: {}}}},
+		"payments": {Group: "payments", Fetched: kadm.OffsetResponses{"e87654321.payments": {0: {}}}},
+		"failed":   {Group: "failed", Err: errors.New("coordinator not available")},
+	}
+
+	assert.Equal(t, []string{"active", "legacy", "orders"}, describable(listed, fetched, "e12345678."))
+}
+
+func TestConsumerGroupsUseSharedResult(t *testing.T) {
+	defer ResetMetadata()
+
+	a := NewKafkaClient(WithBootstrapServers("b:9092", "a:9092"))
+	b := NewKafkaClient(WithBootstrapServers("a:9092", "b:9092"))
+
+	orders := []ConsumerGroup{{Group: "orders", Offsets: map[string]map[int32]int64{"e12345678.orders": {0: 1}}}}
+	cacheEntry(a.groupsKey("e12345678.")).groups = &orders
+	none := []ConsumerGroup(nil)
+	cacheEntry(a.groupsKey("e87654321.")).groups = &none
+
+	groups, err := b.GetConsumerGroups(context.Background(), "e12345678.")
+	assert.NoError(t, err)
+	assert.Equal(t, orders, groups)
+
+	groups, err = b.GetConsumerGroups(context.Background(), "e87654321.")
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+
+	// The groups are looked up again in the next cycle.
+	ResetMetadata()
+	assert.Nil(t, cacheEntry(a.groupsKey("e12345678.")).groups)
+}
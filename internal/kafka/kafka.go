@@ -2,15 +2,20 @@ package kafka
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"github.com/entiros/stargazer-kafka/internal/log"
 	"github.com/entiros/stargazer-kafka/internal/prefix"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
 	"github.com/twmb/franz-go/pkg/sasl"
 	"github.com/twmb/franz-go/pkg/sasl/oauth"
 	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"go.opentelemetry.io/otel/attribute"
 	"net"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -23,10 +28,14 @@ type Client struct {
 	Hosts      []string
 	AuthMethod sasl.Mechanism
 	AWSSession func() *session.Session
+	NamesOnly  bool
+	// Identity is who the client authenticates as, e.g. plain:user, without secrets.
+	Identity string
 }
 
-func (k *Client) Client() (*kgo.Client, error) {
-	return createClient(k.Hosts, k.AuthMethod)
+// Client returns a franz-go client of the cluster with opts, e.g. the partitions to consume.
+func (k *Client) Client(opts ...kgo.Opt) (*kgo.Client, error) {
+	return createClient(k.Hosts, k.AuthMethod, opts...)
 }
 
 func (k *Client) AdminClient() (*kadm.Client, error) {
@@ -53,6 +62,13 @@ func WithBootstrapServers(hosts ...string) func(*Client) {
 	}
 }
 
+// WithNamesOnly makes the client list topic names without keeping partition details when only names are needed.
+func WithNamesOnly(namesOnly bool) func(*Client) {
+	return func(client *Client) {
+		client.NamesOnly = namesOnly
+	}
+}
+
 func WithSession(foo func() *session.Session) func(client *Client) {
 	return func(client *Client) {
 		client.AWSSession = foo
@@ -73,6 +89,8 @@ func WithOAuth(token string) func(client *Client) {
 		client.AuthMethod = oauth.Auth{
 			Token: token,
 		}.AsMechanism()
+		sum := sha256.Sum256([]byte(token))
+		client.Identity = "oauth:" + hex.EncodeToString(sum[:8])
 	}
 }
 
@@ -82,6 +100,7 @@ func WithPassword(username string, password string) func(client *Client) {
 			User: username,
 			Pass: password,
 		}.AsMechanism()
+		client.Identity = "plain:" + username
 	}
 }
 
@@ -92,6 +111,7 @@ func WithIAM(accessKey string, secret string) func(client *Client) {
 
 	return func(client *Client) {
 
+		client.Identity = "iam:" + accessKey
 		client.AuthMethod = faws.ManagedStreamingIAM(func(ctx context.Context) (faws.Auth, error) {
 			sess := client.AWSSession()
 			if sess == nil {
@@ -116,10 +136,11 @@ func WithIAM(accessKey string, secret string) func(client *Client) {
 	}
 }
 
-func createClient(bootstrapServers []string, authMethod sasl.Mechanism) (*kgo.Client, error) {
+func createClient(bootstrapServers []string, authMethod sasl.Mechanism, extra ...kgo.Opt) (*kgo.Client, error) {
 
 	var opts []kgo.Opt
 
+	opts = append(opts, extra...)
 	opts = append(opts, kgo.SeedBrokers(bootstrapServers...))
 	//	opts = append(opts, kgo.WithLogger(kzap.New(log.Logger.Desugar())))
 	if authMethod != nil {
@@ -131,22 +152,24 @@ func createClient(bootstrapServers []string, authMethod sasl.Mechanism) (*kgo.Cl
 
 }
 
-func (c *Client) GetPrefixes(ctx context.Context) ([]string, error) {
+// GetPrefixes returns the prefixes of the topics in the cluster, see Prefixes.
+func (c *Client) GetPrefixes(ctx context.Context, policy *prefix.Policy) ([]string, error) {
 
-	return Prefixes(ctx, c)
+	return Prefixes(ctx, c, policy)
 
 }
 
-func Prefixes(ctx context.Context, c *Client) ([]string, error) {
-	topics, err := c.GetTopics(ctx)
+// Prefixes returns the sorted prefixes found in the topic names of the cluster, as extracted by policy.
+func Prefixes(ctx context.Context, c Admin, policy *prefix.Policy) ([]string, error) {
+	topics, err := c.GetTopicNames(ctx, "")
 	if err != nil {
 		return nil, err
 	}
 
-	var prefixMap map[string]bool
+	prefixMap := make(map[string]bool)
 	for _, topic := range topics {
-		pre, err := prefix.ExtractPrefix(topic.Topic)
-		if err != nil {
+		pre, ok := policy.Extract(topic)
+		if !ok {
 			continue
 		}
 		prefixMap[pre] = true
@@ -156,11 +179,35 @@ func Prefixes(ctx context.Context, c *Client) ([]string, error) {
 	for prefix := range prefixMap {
 		prefixes = append(prefixes, prefix)
 	}
+	sort.Strings(prefixes)
 
 	return prefixes, nil
 }
 
+// Ping checks that the cluster is reachable by listing its brokers.
+func (c *Client) Ping(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	client, err := c.AdminClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	brokers, err := client.ListBrokers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(brokers) == 0 {
+		return fmt.Errorf("no brokers found in %s", c.ClusterKey())
+	}
+	return nil
+}
+
 // GetTopics fetches all the topics from a specified kafka cluster.
+// The metadata is shared with other systems using the same cluster until the next cycle.
 func (c *Client) GetTopics(ctx context.Context) (kadm.TopicDetails, error) {
 
 	return Topics(ctx, c)
@@ -168,6 +215,30 @@ func (c *Client) GetTopics(ctx context.Context) (kadm.TopicDetails, error) {
 
 func Topics(ctx context.Context, c *Client) (kadm.TopicDetails, error) {
 
+	s, err := c.metadata(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.topics, nil
+}
+
+// GetTopicNames returns the sorted names of all topics starting with prefix.
+func (c *Client) GetTopicNames(ctx context.Context, prefix string) ([]string, error) {
+
+	return TopicNames(ctx, c, prefix)
+}
+
+func TopicNames(ctx context.Context, c *Client, prefix string) ([]string, error) {
+
+	s, err := c.metadata(ctx, !c.NamesOnly)
+	if err != nil {
+		return nil, err
+	}
+	return filterNames(s.names, prefix), nil
+}
+
+func fetchTopics(ctx context.Context, c *Client) (kadm.TopicDetails, error) {
+
 	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
@@ -187,53 +258,105 @@ func Topics(ctx context.Context, c *Client) (kadm.TopicDetails, error) {
 	return metadata.Topics, nil
 }
 
-// CreateTopic fetches all the topics from a specified kafka cluster.
-func (c *Client) CreateTopics(ctx context.Context, topics ...string) error {
+func fetchTopicNames(ctx context.Context, c *Client) ([]string, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	client, err := c.AdminClient()
+	if err != nil {
+		log.Logger.Debugf("Failed to create Kafka Admin client. %v", err)
+		return nil, err
+	}
+	defer client.Close()
+
+	topics, err := client.ListTopics(ctx)
+	if err != nil {
+		log.Logger.Debugf("Failed to list topics: %v", err)
+		return nil, err
+	}
+
+	return topics.Names(), nil
+}
+
+// CreateTopics creates the topics and returns the result of each.
+func (c *Client) CreateTopics(ctx context.Context, topics ...string) (TopicResults, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
 	if len(topics) == 0 {
-		return nil
+		return nil, nil
 	}
+
+	ctx, span := tracing.Start(ctx, "kafka create topics", attribute.StringSlice("kafka.topics", topics))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
 	// Get Kafka admin kafkaClient
 	kafkaClient, err := c.AdminClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer kafkaClient.Close()
 
-	_, err = kafkaClient.CreateTopics(ctx, 1, 1, nil, topics...)
+	responses, err := kafkaClient.CreateTopics(ctx, 1, 1, nil, topics...)
+	c.invalidateMetadata()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// TODO: Figure out what we should return here
-	return nil
+	results := make(TopicResults)
+	for _, topic := range topics {
+		response, ok := responses[topic]
+		if !ok {
+			results[topic] = fmt.Errorf("no response")
+			continue
+		}
+		results[topic] = response.Err
+	}
+	// The span records the topics that failed.
+	err = results.Err()
+	return results, nil
 }
 
-// CreateTopic fetches all the topics from a specified kafka cluster.
-func (c *Client) DeleteTopics(ctx context.Context, topics ...string) error {
+// DeleteTopics deletes the topics and returns the result of each.
+func (c *Client) DeleteTopics(ctx context.Context, topics ...string) (TopicResults, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
 	if len(topics) == 0 {
-		return nil
+		return nil, nil
 	}
 
+	ctx, span := tracing.Start(ctx, "kafka delete topics", attribute.StringSlice("kafka.topics", topics))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
 	// Get Kafka admin kafkaClient
 	kafkaClient, err := c.AdminClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer kafkaClient.Close()
 
-	_, err = kafkaClient.DeleteTopics(ctx, topics...)
+	responses, err := kafkaClient.DeleteTopics(ctx, topics...)
+	c.invalidateMetadata()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// TODO: Figure out what we should return here
-	return nil
+	results := make(TopicResults)
+	for _, topic := range topics {
+		response, ok := responses[topic]
+		if !ok {
+			results[topic] = fmt.Errorf("no response")
+			continue
+		}
+		results[topic] = response.Err
+	}
+	// The span records the topics that failed.
+	err = results.Err()
+	return results, nil
 }
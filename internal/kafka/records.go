@@ -0,0 +1,186 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Record is a record read from a topic.
+type Record struct {
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+}
+
+// Header is a header of a record.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Producer writes records to topics. Client produces to Kafka, fake.Cluster in memory.
+type Producer interface {
+	Produce(ctx context.Context, topic string, records ...Record) error
+}
+
+var _ Producer = (*Client)(nil)
+
+// producers are the producers of each cluster and identity. Clients are created again every cycle, so they
+// live here until CloseProducers is called on shutdown.
+var producers = struct {
+	sync.Mutex
+	clients map[string]*kgo.Client
+}{
+	clients: make(map[string]*kgo.Client),
+}
+
+// producer returns the producer of the cluster as the identity of the client, created on first use.
+func (c *Client) producer() (*kgo.Client, error) {
+	producers.Lock()
+	defer producers.Unlock()
+
+	key := c.metadataKey()
+	if producer, ok := producers.clients[key]; ok {
+		return producer, nil
+	}
+	producer, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+	producers.clients[key] = producer
+	return producer, nil
+}
+
+// CloseProducers closes the producers of all clusters. Call once on shutdown, after the last Produce.
+func CloseProducers() {
+	producers.Lock()
+	defer producers.Unlock()
+
+	for key, producer := range producers.clients {
+		producer.Close()
+		delete(producers.clients, key)
+	}
+}
+
+// Produce writes the records to the topic and waits until all of them are acknowledged. The partitions and
+// offsets of the records are left to Kafka. Clients of the same cluster and identity share one idempotent
+// producer, so retries do not write records twice.
+func (c *Client) Produce(ctx context.Context, topic string, records ...Record) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	producer, err := c.producer()
+	if err != nil {
+		return err
+	}
+
+	produced := make([]*kgo.Record, 0, len(records))
+	for _, record := range records {
+		r := &kgo.Record{Topic: topic, Key: record.Key, Value: record.Value}
+		for _, header := range record.Headers {
+			r.Headers = append(r.Headers, kgo.RecordHeader{Key: header.Key, Value: header.Value})
+		}
+		produced = append(produced, r)
+	}
+	return producer.ProduceSync(ctx, produced...).FirstErr()
+}
+
+// SampleRecords reads up to n of the latest records of the topic, spread over its partitions. The partitions are
+// assigned to the consumer directly instead of through a consumer group, so no offsets are ever committed.
+// Records not read within the timeout are left out.
+func (c *Client) SampleRecords(ctx context.Context, topic string, n int) ([]Record, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if n <= 0 {
+		return nil, nil
+	}
+
+	adminClient, err := c.AdminClient()
+	if err != nil {
+		return nil, err
+	}
+	defer adminClient.Close()
+
+	starts, err := adminClient.ListStartOffsets(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	ends, err := adminClient.ListEndOffsets(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	// The latest records of each partition with any, n in all.
+	var partitions []int32
+	for partition, end := range ends[topic] {
+		start, ok := starts.Lookup(topic, partition)
+		if end.Err == nil && ok && start.Err == nil && end.Offset > start.Offset {
+			partitions = append(partitions, partition)
+		}
+	}
+	if len(partitions) == 0 {
+		return nil, nil
+	}
+	perPartition := int64((n + len(partitions) - 1) / len(partitions))
+
+	offsets := make(map[int32]kgo.Offset)
+	remaining := make(map[int32]int64)
+	for _, partition := range partitions {
+		start, end := starts[topic][partition].Offset, ends[topic][partition].Offset
+		from := end - perPartition
+		if from < start {
+			from = start
+		}
+		offsets[partition] = kgo.NewOffset().At(from)
+		remaining[partition] = end
+	}
+
+	consumer, err := c.Client(
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{topic: offsets}),
+		kgo.FetchMaxWait(time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	var records []Record
+	for len(remaining) > 0 && len(records) < n {
+		fetches := consumer.PollRecords(ctx, n-len(records))
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			log.Logger.Debugf("Sampled %d records of %s before timing out", len(records), topic)
+			break
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			log.Logger.Debugf("Failed to fetch records of %s/%d: %v", topic, partition, err)
+		})
+		fetches.EachRecord(func(r *kgo.Record) {
+			end, ok := remaining[r.Partition]
+			if !ok || len(records) >= n {
+				return
+			}
+			record := Record{Partition: r.Partition, Offset: r.Offset, Key: r.Key, Value: r.Value}
+			for _, header := range r.Headers {
+				record.Headers = append(record.Headers, Header{Key: header.Key, Value: header.Value})
+			}
+			records = append(records, record)
+			if r.Offset+1 >= end {
+				delete(remaining, r.Partition)
+			}
+		})
+	}
+	return records, nil
+}
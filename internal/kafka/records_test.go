@@ -0,0 +1,30 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducerIsShared(t *testing.T) {
+
+	t.Cleanup(CloseProducers)
+	orders := NewKafkaClient(WithBootstrapServers("kafka-2:9092", "kafka-1:9092"), WithPassword("orders", "secret"))
+	audit := NewKafkaClient(WithBootstrapServers("kafka-1:9092", "kafka-2:9092"), WithPassword("orders", "secret"))
+	payments := NewKafkaClient(WithBootstrapServers("kafka-1:9092", "kafka-2:9092"), WithPassword("payments", "secret"))
+
+	// Clients of the same cluster and identity, e.g. of the next cycle, share one producer.
+	producer, err := orders.producer()
+	assert.NoError(t, err)
+	shared, err := audit.producer()
+	assert.NoError(t, err)
+	assert.Same(t, producer, shared)
+	other, err := payments.producer()
+	assert.NoError(t, err)
+	assert.NotSame(t, producer, other)
+
+	CloseProducers()
+	again, err := orders.producer()
+	assert.NoError(t, err)
+	assert.NotSame(t, producer, again)
+}
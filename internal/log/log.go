@@ -1,7 +1,9 @@
 package log
 
 import (
+	"context"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"os"
@@ -48,6 +50,20 @@ func init() {
 
 }
 
+// Ctx returns the logger with the trace and span id of ctx added, if ctx carries a span.
+func Ctx(ctx context.Context) *zap.SugaredLogger {
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return &Logger.SugaredLogger
+	}
+
+	return Logger.With(
+		"trace_id", spanContext.TraceID().String(),
+		"span_id", spanContext.SpanID().String(),
+	)
+}
+
 func SetDebugLevel(level string) {
 
 	switch strings.ToLower(strings.TrimSpace(level)) {
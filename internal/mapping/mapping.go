@@ -0,0 +1,230 @@
+// Package mapping maps Starlify endpoint names to Kafka topic names and back.
+package mapping
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxTopicLength is the longest topic name Kafka accepts.
+const MaxTopicLength = 249
+
+// Case conversions of endpoint names.
+const (
+	CaseLower = "lower"
+	CaseUpper = "upper"
+)
+
+// Replacement substitutes From in endpoint names with To in topic names.
+type Replacement struct {
+	From string
+	To   string
+}
+
+// Rules describe how endpoint names become topic names. The zero value maps names as they are.
+type Rules struct {
+	// AddPrefix adds the Kafka prefix to endpoint names, and strips it from topic names.
+	// It is the same as a template starting with {prefix}.
+	AddPrefix bool
+	// Case is CaseLower or CaseUpper to convert endpoint names, empty to keep them.
+	Case string
+	// Replace substitutes characters, e.g. spaces that are not allowed in topic names.
+	Replace []Replacement
+	// Template of topic names, e.g. {prefix}{domain}.{name}.v{version}. {name} is the endpoint name,
+	// {prefix} the Kafka prefix and other variables come from endpoint attributes or Variables.
+	Template string
+	// Variables are the values of template variables that endpoints have no attribute for.
+	Variables map[string]string
+}
+
+var variablePattern = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
+
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// template returns the template of the rules, always containing {name}.
+func (r *Rules) template() string {
+
+	template := r.Template
+	if template == "" {
+		template = "{name}"
+	}
+	if r.AddPrefix && !strings.Contains(template, "{prefix}") {
+		template = "{prefix}" + template
+	}
+	return template
+}
+
+// Validate checks that the rules can be used.
+func (r *Rules) Validate() error {
+
+	if r == nil {
+		return nil
+	}
+	switch r.Case {
+	case "", CaseLower, CaseUpper:
+	default:
+		return fmt.Errorf("invalid case '%s', valid values are %s or %s", r.Case, CaseLower, CaseUpper)
+	}
+	for _, replacement := range r.Replace {
+		if replacement.From == "" {
+			return fmt.Errorf("replacement of '%s' has nothing to replace", replacement.To)
+		}
+	}
+	if strings.Count(r.template(), "{name}") != 1 {
+		return fmt.Errorf("template '%s' must contain {name} once", r.Template)
+	}
+	return nil
+}
+
+// ToTopic returns the topic name of the endpoint. Template variables are looked up in attributes,
+// then in the variables of the rules. The topic name is validated.
+func (r *Rules) ToTopic(prefix string, name string, attributes map[string]string) (string, error) {
+
+	name = strings.TrimSpace(name)
+	if r == nil {
+		return name, ValidateTopic(name)
+	}
+
+	var missing []string
+	topic := variablePattern.ReplaceAllStringFunc(r.template(), func(v string) string {
+		variable := v[1 : len(v)-1]
+		switch variable {
+		case "prefix":
+			return prefix
+		case "name":
+			return r.convert(name)
+		}
+		if value, ok := attributes[variable]; ok {
+			return r.convert(value)
+		}
+		if value, ok := r.Variables[variable]; ok {
+			return r.convert(value)
+		}
+		missing = append(missing, variable)
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value for %v in template of endpoint %s", missing, name)
+	}
+
+	return topic, ValidateTopic(topic)
+}
+
+// ToEndpoint returns the endpoint name of the topic and the values of the other template variables,
+// or false if the topic does not match the template. Case conversion can't be undone, replacements
+// are undone where they are unambiguous.
+func (r *Rules) ToEndpoint(prefix string, topic string) (string, map[string]string, bool) {
+
+	if r == nil {
+		return topic, nil, true
+	}
+
+	pattern := "^"
+	template := r.template()
+	seen := make(map[string]bool)
+	last := 0
+	for _, loc := range variablePattern.FindAllStringSubmatchIndex(template, -1) {
+		pattern += regexp.QuoteMeta(template[last:loc[0]])
+		variable := template[loc[2]:loc[3]]
+		switch {
+		case variable == "prefix":
+			pattern += regexp.QuoteMeta(prefix)
+		case variable == "name":
+			pattern += "(?P<name>.+)"
+		case seen[variable]:
+			pattern += "[^.]+"
+		default:
+			pattern += "(?P<" + variable + ">[^.]+)"
+		}
+		seen[variable] = true
+		last = loc[1]
+	}
+	pattern += regexp.QuoteMeta(template[last:]) + "$"
+
+	re := regexp.MustCompile(pattern)
+	match := re.FindStringSubmatch(topic)
+	if match == nil {
+		return "", nil, false
+	}
+
+	var name string
+	variables := make(map[string]string)
+	for i, group := range re.SubexpNames() {
+		switch group {
+		case "":
+		case "name":
+			name = r.unconvert(match[i])
+		default:
+			variables[group] = r.unconvert(match[i])
+		}
+	}
+	return name, variables, true
+}
+
+// unconvert undoes the replacements of convert.
+func (r *Rules) unconvert(s string) string {
+
+	for i := len(r.Replace) - 1; i >= 0; i-- {
+		if replacement := r.Replace[i]; replacement.To != "" {
+			s = strings.ReplaceAll(s, replacement.To, replacement.From)
+		}
+	}
+	return s
+}
+
+// convert applies case conversion and replacements to a part of an endpoint name.
+func (r *Rules) convert(s string) string {
+
+	switch r.Case {
+	case CaseLower:
+		s = strings.ToLower(s)
+	case CaseUpper:
+		s = strings.ToUpper(s)
+	}
+	for _, replacement := range r.Replace {
+		s = strings.ReplaceAll(s, replacement.From, replacement.To)
+	}
+	return s
+}
+
+// ValidateTopic checks topic against the rules Kafka has for topic names.
+func ValidateTopic(topic string) error {
+
+	if topic == "" {
+		return fmt.Errorf("topic name is empty")
+	}
+	if topic == "." || topic == ".." {
+		return fmt.Errorf("topic name can't be '%s'", topic)
+	}
+	if len(topic) > MaxTopicLength {
+		return fmt.Errorf("topic name %s is %d characters, the maximum is %d", topic, len(topic), MaxTopicLength)
+	}
+	if !topicPattern.MatchString(topic) {
+		return fmt.Errorf("topic name %s may only contain ASCII letters, digits, '.', '_' and '-'", topic)
+	}
+	return nil
+}
+
+// Collisions returns the groups of topics that only differ in '.' and '_'. Kafka allows them,
+// but they collide in metric names.
+func Collisions(topics []string) [][]string {
+
+	byMetricName := make(map[string][]string)
+	var order []string
+	for _, topic := range topics {
+		key := strings.ReplaceAll(topic, ".", "_")
+		if _, ok := byMetricName[key]; !ok {
+			order = append(order, key)
+		}
+		byMetricName[key] = append(byMetricName[key], topic)
+	}
+
+	var collisions [][]string
+	for _, key := range order {
+		if len(byMetricName[key]) > 1 {
+			collisions = append(collisions, byMetricName[key])
+		}
+	}
+	return collisions
+}
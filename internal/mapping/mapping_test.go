@@ -0,0 +1,72 @@
+package mapping
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules_ToTopic(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		rules      *Rules
+		endpoint   string
+		attributes map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{"No rules", nil, "e12345678.orders", nil, "e12345678.orders", false},
+		{"No rules, invalid", nil, "e12345678.my orders", nil, "e12345678.my orders", true},
+		{"Add prefix", &Rules{AddPrefix: true}, "orders", nil, "e12345678.orders", false},
+		{"Case and replace", &Rules{AddPrefix: true, Case: CaseLower, Replace: []Replacement{{" ", "-"}}}, "My Orders", nil, "e12345678.my-orders", false},
+		{"Template", &Rules{Template: "{prefix}{domain}.{name}.v{version}", Variables: map[string]string{"version": "1"}},
+			"orders", map[string]string{"domain": "sales"}, "e12345678.sales.orders.v1", false},
+		{"Attribute before variable", &Rules{Template: "{prefix}{name}.v{version}", Variables: map[string]string{"version": "1"}},
+			"orders", map[string]string{"version": "2"}, "e12345678.orders.v2", false},
+		{"Missing variable", &Rules{Template: "{prefix}{domain}.{name}"}, "orders", nil, "", true},
+		{"Too long", &Rules{AddPrefix: true}, strings.Repeat("a", 240), nil, "e12345678." + strings.Repeat("a", 240), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.ToTopic("e12345678.", tt.endpoint, tt.attributes)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err != nil, "error: %v", err)
+		})
+	}
+}
+
+func TestRules_ToEndpoint(t *testing.T) {
+
+	rules := &Rules{Template: "{prefix}{domain}.{name}.v{version}", Replace: []Replacement{{" ", "-"}}}
+
+	name, variables, ok := rules.ToEndpoint("e12345678.", "e12345678.sales.my-orders.v2")
+	assert.True(t, ok)
+	assert.Equal(t, "my orders", name)
+	assert.Equal(t, map[string]string{"domain": "sales", "version": "2"}, variables)
+
+	topic, err := rules.ToTopic("e12345678.", name, variables)
+	assert.NoError(t, err)
+	assert.Equal(t, "e12345678.sales.my-orders.v2", topic)
+
+	_, _, ok = rules.ToEndpoint("e12345678.", "e12345678.orders")
+	assert.False(t, ok)
+
+	name, _, ok = (&Rules{AddPrefix: true}).ToEndpoint("e12345678.", "e12345678.orders")
+	assert.True(t, ok)
+	assert.Equal(t, "orders", name)
+}
+
+func TestRules_Validate(t *testing.T) {
+	assert.NoError(t, (*Rules)(nil).Validate())
+	assert.NoError(t, (&Rules{AddPrefix: true}).Validate())
+	assert.Error(t, (&Rules{Case: "title"}).Validate())
+	assert.Error(t, (&Rules{Template: "{prefix}{domain}"}).Validate())
+	assert.Error(t, (&Rules{Replace: []Replacement{{"", "-"}}}).Validate())
+}
+
+func TestCollisions(t *testing.T) {
+	assert.Equal(t, [][]string{{"a.b", "a_b"}}, Collisions([]string{"a.b", "c", "a_b"}))
+	assert.Empty(t, Collisions([]string{"a.b", "a-b"}))
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ConsumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stargazer_consumer_group_lag",
+	Help: "Number of messages a consumer group is behind the end of a partition",
+}, []string{"system", "group", "topic", "partition"})
+
+var ProducedRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stargazer_topic_produced_messages_per_second",
+	Help: "Messages produced to a topic per second, measured between two syncs",
+}, []string{"system", "topic"})
+
+func init() {
+	prometheus.MustRegister(ConsumerLag)
+	prometheus.MustRegister(ProducedRate)
+}
+
+type endOffsets struct {
+	offsets map[string]map[int32]int64
+	at      time.Time
+}
+
+// previousEndOffsets holds the end offsets seen in the previous sync of each system.
+var previousEndOffsets = struct {
+	sync.Mutex
+	systems map[string]endOffsets
+}{
+	systems: make(map[string]endOffsets),
+}
+
+// SetConsumerLag replaces the lag of all groups of the system. Lag is the distance from the committed
+// offset to the end offset; partitions without a committed offset are left out.
+func SetConsumerLag(system string, committed map[string]map[string]map[int32]int64, end map[string]map[int32]int64) {
+
+	ConsumerLag.DeletePartialMatch(prometheus.Labels{"system": system})
+
+	for group, topics := range committed {
+		for topic, partitions := range topics {
+			for partition, offset := range partitions {
+				endOffset, ok := end[topic][partition]
+				if !ok || offset < 0 {
+					continue
+				}
+				lag := endOffset - offset
+				if lag < 0 {
+					lag = 0
+				}
+				ConsumerLag.WithLabelValues(system, group, topic, strconv.Itoa(int(partition))).Set(float64(lag))
+			}
+		}
+	}
+}
+
+// SetEndOffsets records the end offsets of the system and updates the produced rate of every topic
+// against the offsets recorded in the previous call.
+func SetEndOffsets(system string, end map[string]map[int32]int64, at time.Time) {
+
+	previousEndOffsets.Lock()
+	defer previousEndOffsets.Unlock()
+
+	ProducedRate.DeletePartialMatch(prometheus.Labels{"system": system})
+
+	previous, ok := previousEndOffsets.systems[system]
+	previousEndOffsets.systems[system] = endOffsets{offsets: end, at: at}
+	if !ok {
+		return
+	}
+
+	seconds := at.Sub(previous.at).Seconds()
+	if seconds <= 0 {
+		return
+	}
+
+	for topic, partitions := range end {
+		before, ok := previous.offsets[topic]
+		if !ok {
+			continue
+		}
+		var produced int64
+		for partition, offset := range partitions {
+			if b, ok := before[partition]; ok && offset > b {
+				produced += offset - b
+			}
+		}
+		ProducedRate.WithLabelValues(system, topic).Set(float64(produced) / seconds)
+	}
+}
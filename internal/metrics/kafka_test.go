@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetConsumerLag(t *testing.T) {
+
+	committed := map[string]map[string]map[int32]int64{
+		"orders": {"e12345678.orders": {0: 10, 1: -1}},
+	}
+	end := map[string]map[int32]int64{
+		"e12345678.orders": {0: 15, 1: 3},
+	}
+
+	SetConsumerLag("lag-test", committed, end)
+
+	assert.Equal(t, 5.0, testutil.ToFloat64(ConsumerLag.WithLabelValues("lag-test", "orders", "e12345678.orders", "0")))
+	assert.Equal(t, 1, testutil.CollectAndCount(ConsumerLag))
+}
+
+func TestSetEndOffsets(t *testing.T) {
+
+	start := time.Now()
+	SetEndOffsets("rate-test", map[string]map[int32]int64{"e12345678.orders": {0: 100, 1: 50}}, start)
+	assert.Equal(t, 0, testutil.CollectAndCount(ProducedRate))
+
+	SetEndOffsets("rate-test", map[string]map[int32]int64{"e12345678.orders": {0: 110, 1: 60}}, start.Add(10*time.Second))
+	assert.Equal(t, 2.0, testutil.ToFloat64(ProducedRate.WithLabelValues("rate-test", "e12345678.orders")))
+}
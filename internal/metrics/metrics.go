@@ -16,9 +16,110 @@ var ErrCount = prometheus.NewCounter(prometheus.CounterOpts{
 	Help: "Number of errors while performing sync",
 })
 
+var SyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "stargazer_sync_duration_seconds",
+	Help:    "Duration of a sync of one system",
+	Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+}, []string{"system", "prefix"})
+
+var TopicsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "stargazer_topics_created_total",
+	Help: "Number of topics (or endpoints) created by sync",
+}, []string{"system", "prefix"})
+
+var TopicsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "stargazer_topics_deleted_total",
+	Help: "Number of topics (or endpoints) deleted by sync",
+}, []string{"system", "prefix"})
+
+var EndpointsUpdated = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "stargazer_endpoints_updated_total",
+	Help: "Number of endpoints whose attributes were updated from Kafka",
+}, []string{"system", "prefix"})
+
+var TopicsUnderPrefix = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stargazer_topics_under_prefix",
+	Help: "Number of topics under the prefix after the last sync",
+}, []string{"system", "prefix"})
+
+var LastSuccessfulSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stargazer_last_successful_sync_timestamp_seconds",
+	Help: "Unix time of the last successful sync",
+}, []string{"system", "prefix"})
+
+var Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "stargazer_errors_total",
+	Help: "Number of errors while performing sync, by category (kafka, starlify, config)",
+}, []string{"system", "category"})
+
+var StarlifyRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "stargazer_starlify_request_duration_seconds",
+	Help:    "Duration of requests to the Starlify API",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+var StarlifyLimiterWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "stargazer_starlify_limiter_wait_seconds",
+	Help:    "Time requests to the Starlify API waited for the client side rate limiter",
+	Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+})
+
+var WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "stargazer_webhook_deliveries_total",
+	Help: "Number of webhook notifications by result (delivered, failed or dropped), undelivered ones are in the dead-letter log",
+}, []string{"system", "result"})
+
+var SubjectsChanged = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "stargazer_schema_subjects_changed_total",
+	Help: "Number of Schema Registry subjects registered, given a compatibility or deleted along with topics",
+}, []string{"system", "action"})
+
+var UnmanagedPrefixes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stargazer_unmanaged_prefix",
+	Help: "Prefixes of topics in a cluster that no configured system manages, 1 for each prefix",
+}, []string{"cluster", "prefix"})
+
+// SetUnmanagedPrefixes replaces the unmanaged prefixes of all clusters.
+func SetUnmanagedPrefixes(unmanaged map[string][]string) {
+	UnmanagedPrefixes.Reset()
+	for cluster, prefixes := range unmanaged {
+		for _, prefix := range prefixes {
+			UnmanagedPrefixes.WithLabelValues(cluster, prefix).Set(1)
+		}
+	}
+}
+
+var OrphanedTopics = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "stargazer_orphaned_topics",
+	Help: "Number of topics without a prefix in a cluster, by kind (unprefixed, internal)",
+}, []string{"cluster", "kind"})
+
+// SetOrphanedTopics replaces the numbers of orphaned topics of all clusters.
+func SetOrphanedTopics(orphans map[string]map[string][]string) {
+	OrphanedTopics.Reset()
+	for cluster, kinds := range orphans {
+		for kind, topics := range kinds {
+			OrphanedTopics.WithLabelValues(cluster, kind).Set(float64(len(topics)))
+		}
+	}
+}
+
 func init() {
 	prometheus.MustRegister(SyncCount)
 	prometheus.MustRegister(ErrCount)
+	prometheus.MustRegister(SyncDuration)
+	prometheus.MustRegister(TopicsCreated)
+	prometheus.MustRegister(TopicsDeleted)
+	prometheus.MustRegister(TopicsUnderPrefix)
+	prometheus.MustRegister(EndpointsUpdated)
+	prometheus.MustRegister(LastSuccessfulSync)
+	prometheus.MustRegister(Errors)
+	prometheus.MustRegister(StarlifyRequestDuration)
+	prometheus.MustRegister(StarlifyLimiterWait)
+	prometheus.MustRegister(SubjectsChanged)
+	prometheus.MustRegister(WebhookDeliveries)
+	prometheus.MustRegister(UnmanagedPrefixes)
+	prometheus.MustRegister(OrphanedTopics)
 
 }
 
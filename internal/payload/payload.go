@@ -0,0 +1,260 @@
+// Package payload detects the format of Kafka record keys and values, and infers the structure of JSON values.
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+)
+
+// Payload formats.
+const (
+	Empty = "empty"
+	JSON  = "json"
+	// Avro and Protobuf are the Confluent wire format, a zero magic byte and a schema id before the data.
+	Avro     = "avro"
+	Protobuf = "protobuf"
+	Text     = "text"
+	Binary   = "binary"
+)
+
+// Summary describes a sample of records.
+type Summary struct {
+	// Records is the number of records sampled.
+	Records int
+	// Format and KeyFormat are the most common formats of the values and keys that are not empty.
+	Format    string
+	KeyFormat string
+	// Structure is the merged structure of the JSON values as JSON, e.g. {"id":"number","tags":["string"]}.
+	// Fields whose type differs between records have all the types, e.g. "number|string".
+	Structure string
+	// Headers are the sorted keys of the headers of the records.
+	Headers []string
+}
+
+// Detect returns the format of data.
+func Detect(data []byte) string {
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return Empty
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed):
+		return JSON
+	case len(data) > 5 && data[0] == 0:
+		// A message index list of [0] is written as a single zero, and is followed by protobuf fields.
+		if data[5] == 0 && isProtobuf(data[6:]) {
+			return Protobuf
+		}
+		return Avro
+	case isText(data):
+		return Text
+	default:
+		return Binary
+	}
+}
+
+// isText reports whether data is UTF-8 without control characters other than whitespace.
+func isText(data []byte) bool {
+
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isProtobuf reports whether data is a sequence of protobuf fields. An empty message is.
+func isProtobuf(data []byte) bool {
+
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 || tag>>3 == 0 {
+			return false
+		}
+		data = data[n:]
+		switch tag & 7 {
+		case 0:
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				return false
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return false
+			}
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return false
+			}
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return false
+			}
+			data = data[4:]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Summarize returns the summary of the records.
+func Summarize(records []kafka.Record) Summary {
+
+	summary := Summary{Records: len(records)}
+	formats := make(map[string]int)
+	keyFormats := make(map[string]int)
+	headers := make(map[string]bool)
+	var structure any
+
+	for _, record := range records {
+		format := Detect(record.Value)
+		formats[format]++
+		keyFormats[Detect(record.Key)]++
+		for _, header := range record.Headers {
+			headers[header.Key] = true
+		}
+		if format == JSON {
+			var value any
+			if json.Unmarshal(record.Value, &value) == nil {
+				structure = merge(structure, infer(value))
+			}
+		}
+	}
+
+	summary.Format = mostCommon(formats)
+	summary.KeyFormat = mostCommon(keyFormats)
+	if structure != nil {
+		if encoded, err := json.Marshal(structure); err == nil {
+			summary.Structure = string(encoded)
+		}
+	}
+	for header := range headers {
+		summary.Headers = append(summary.Headers, header)
+	}
+	sort.Strings(summary.Headers)
+	return summary
+}
+
+// mostCommon returns the most common format that is not empty, the first by name on a tie.
+func mostCommon(counts map[string]int) string {
+
+	var best string
+	for format, count := range counts {
+		if format == Empty {
+			continue
+		}
+		if best == "" || count > counts[best] || count == counts[best] && format < best {
+			best = format
+		}
+	}
+	return best
+}
+
+// infer returns the structure of a decoded JSON value: a map of the structures of the fields of objects,
+// a slice of the merged structure of the elements of arrays, or the name of the type of other values.
+func infer(value any) any {
+
+	switch v := value.(type) {
+	case map[string]any:
+		fields := make(map[string]any)
+		for name, field := range v {
+			fields[name] = infer(field)
+		}
+		return fields
+	case []any:
+		var elements any
+		for _, element := range v {
+			elements = merge(elements, infer(element))
+		}
+		if elements == nil {
+			return []any{}
+		}
+		return []any{elements}
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// merge returns the structure of values of both structures a and b.
+func merge(a any, b any) any {
+
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	switch x := a.(type) {
+	case map[string]any:
+		if y, ok := b.(map[string]any); ok {
+			fields := make(map[string]any)
+			for name, field := range x {
+				fields[name] = field
+			}
+			for name, field := range y {
+				fields[name] = merge(fields[name], field)
+			}
+			return fields
+		}
+	case []any:
+		if y, ok := b.([]any); ok {
+			var elements any
+			for _, element := range append(append([]any{}, x...), y...) {
+				elements = merge(elements, element)
+			}
+			if elements == nil {
+				return []any{}
+			}
+			return []any{elements}
+		}
+	}
+
+	types := make(map[string]bool)
+	for _, t := range append(strings.Split(typeName(a), "|"), strings.Split(typeName(b), "|")...) {
+		types[t] = true
+	}
+	var names []string
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// typeName returns the name of the type of a structure.
+func typeName(structure any) string {
+
+	switch s := structure.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return s
+	default:
+		return "null"
+	}
+}
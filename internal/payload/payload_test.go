@@ -0,0 +1,50 @@
+package payload
+
+import (
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+	}{
+		{"empty", nil, Empty},
+		{"json object", []byte(` {"id": 1}`), JSON},
+		{"json array", []byte(`[1, 2]`), JSON},
+		{"json scalar", []byte(`42`), Text},
+		{"invalid json", []byte(`{"id": `), Text},
+		{"avro", []byte{0, 0, 0, 0, 7, 2, 'a'}, Avro},
+		{"protobuf", []byte{0, 0, 0, 0, 7, 0, 0x08, 0x96, 0x01, 0x12, 0x01, 'a'}, Protobuf},
+		{"text", []byte("order created\n"), Text},
+		{"binary", []byte{0xff, 0x01, 0x02}, Binary},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.format, Detect(test.data))
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+
+	summary := Summarize([]kafka.Record{
+		{Key: []byte("1"), Value: []byte(`{"id":1,"tags":["a"],"customer":{"name":"x"}}`), Headers: []kafka.Header{{Key: "trace-id"}}},
+		{Key: []byte("2"), Value: []byte(`{"id":"2","tags":[],"note":null}`), Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/json")}, {Key: "trace-id"}}},
+		{Key: []byte("3"), Value: nil},
+		{Value: []byte("not json")},
+	})
+
+	assert.Equal(t, 4, summary.Records)
+	assert.Equal(t, JSON, summary.Format)
+	assert.Equal(t, Text, summary.KeyFormat)
+	assert.Equal(t, `{"customer":{"name":"string"},"id":"number|string","note":"null","tags":["string"]}`, summary.Structure)
+	assert.Equal(t, []string{"content-type", "trace-id"}, summary.Headers)
+
+	assert.Equal(t, Summary{}, Summarize(nil))
+}
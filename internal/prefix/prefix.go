@@ -2,45 +2,156 @@ package prefix
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
-// Validate prefix.
-// Prefix example e85da0fd6.
-func Validate(prefix string) error {
+// Policy decides which Kafka prefixes are valid and which topics are managed under a prefix.
+// A nil Policy is Default.
+type Policy struct {
+	// Pattern is a regular expression the prefix must match, empty to allow any.
+	Pattern string
+	// Separators are the characters the prefix may end with, empty to allow any.
+	Separators string
+	// MinLength and MaxLength limit the length of the prefix, 0 for no limit.
+	MinLength int
+	MaxLength int
+	// Topics, when set, are the only topics managed and no prefix is used.
+	Topics []string
+}
+
+// Default is the Starlify prefix, e.g. e85da0fd6.
+var Default = Policy{Pattern: "^e", Separators: ".", MinLength: 10, MaxLength: 10}
+
+// ShortestPrefix is the shortest prefix a policy without separators may allow, so that a prefix like "e"
+// can't take over every topic starting with it.
+const ShortestPrefix = 8
+
+// Check validates the policy itself.
+func (p *Policy) Check() error {
+
+	if p == nil {
+		return nil
+	}
+	if _, err := regexp.Compile(p.Pattern); err != nil {
+		return fmt.Errorf("invalid prefix pattern '%s'. %v", p.Pattern, err)
+	}
+	if p.MinLength < 0 || p.MaxLength < 0 || (p.MaxLength > 0 && p.MinLength > p.MaxLength) {
+		return fmt.Errorf("invalid prefix length %d to %d", p.MinLength, p.MaxLength)
+	}
+	if len(p.Topics) == 0 && p.Separators == "" && p.MinLength < ShortestPrefix {
+		return fmt.Errorf("prefix without separators must have a minimum length of at least %d", ShortestPrefix)
+	}
+	return nil
+}
+
+// Validate checks prefix against the policy. Any prefix is valid when the policy has topics.
+func (p *Policy) Validate(prefix string) error {
+
+	if p == nil {
+		p = &Default
+	}
+	if len(p.Topics) > 0 {
+		return nil
+	}
 
-	if len(prefix) != 10 {
-		return fmt.Errorf("prefix length must be 9. Found a prefix of length %d", len(prefix))
+	if prefix == "" {
+		return fmt.Errorf("prefix is empty")
 	}
 
-	if !strings.HasPrefix(prefix, "e") {
-		return fmt.Errorf("prefix must start with 'e'")
+	if p.MinLength > 0 && len(prefix) < p.MinLength || p.MaxLength > 0 && len(prefix) > p.MaxLength {
+		if p.MinLength == p.MaxLength {
+			return fmt.Errorf("prefix length must be %d. Found a prefix of length %d", p.MinLength, len(prefix))
+		}
+		return fmt.Errorf("prefix length must be %d to %d. Found a prefix of length %d", p.MinLength, p.MaxLength, len(prefix))
 	}
 
-	if !strings.HasSuffix(prefix, ".") {
-		return fmt.Errorf("prefix must end with '.'")
+	if p.Pattern != "" {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(prefix) {
+			return fmt.Errorf("prefix %s must match '%s'", prefix, p.Pattern)
+		}
+	}
+
+	if p.Separators != "" && !strings.ContainsAny(prefix[len(prefix)-1:], p.Separators) {
+		return fmt.Errorf("prefix must end with one of '%s'", p.Separators)
 	}
 
 	return nil
 }
 
-func ExtractPrefix(topic string) (string, error) {
+// Resolve returns the prefix to use for the prefix of a middleware: the validated prefix,
+// or an empty prefix if the policy has topics.
+func (p *Policy) Resolve(prefix string) (string, error) {
 
-	err := Validate(topic[0:10])
-	if err != nil {
-		return "", err
+	if p != nil && len(p.Topics) > 0 {
+		return "", nil
 	}
-	return topic[0:10], nil
+	prefix = strings.TrimSpace(prefix)
+	return prefix, p.Validate(prefix)
+}
+
+// Manages reports whether the topic is managed under prefix, that is, it starts with prefix
+// or, if the policy has topics, is one of them.
+func (p *Policy) Manages(prefix string, topic string) bool {
 
+	if p == nil || len(p.Topics) == 0 {
+		return strings.HasPrefix(topic, prefix)
+	}
+	for _, t := range p.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
 }
 
-func HasPrefix(topic string) bool {
+// Extract returns the prefix of the topic, the shortest start of the topic name ending with a separator
+// that is a valid prefix. It reports false if there is none, or if the policy has topics or no separators.
+func (p *Policy) Extract(topic string) (string, bool) {
 
-	err := Validate(topic[0:10])
-	if err != nil {
-		return true
+	if p == nil {
+		p = &Default
+	}
+	if len(p.Topics) > 0 || p.Separators == "" {
+		return "", false
 	}
 
-	return false
+	for i := 0; i < len(topic); i++ {
+		if !strings.ContainsRune(p.Separators, rune(topic[i])) {
+			continue
+		}
+		if p.Validate(topic[:i+1]) == nil {
+			return topic[:i+1], true
+		}
+	}
+	return "", false
+}
+
+// Validate prefix against the Default policy.
+// Prefix example e85da0fd6.
+func Validate(prefix string) error {
+	return Default.Validate(prefix)
+}
+
+// ExtractPrefix returns the prefix of the topic under the Default policy.
+func ExtractPrefix(topic string) (string, error) {
+
+	prefix, ok := Default.Extract(topic)
+	if !ok {
+		return "", fmt.Errorf("topic %s has no prefix", topic)
+	}
+	return prefix, nil
+
+}
+
+// HasPrefix reports whether the topic has a prefix under the Default policy.
+func HasPrefix(topic string) bool {
+
+	_, ok := Default.Extract(topic)
+	return ok
 
 }
@@ -0,0 +1,102 @@
+package prefix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+
+	team := &Policy{Pattern: "^team-[a-z]+", Separators: "-_", MinLength: 6, MaxLength: 20}
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		prefix  string
+		wantErr string
+	}{
+		{"Default", nil, "e85da0fd6.", ""},
+		{"Default, too short", nil, "e85da0f.", "prefix length must be 10. Found a prefix of length 8"},
+		{"Default, wrong start", nil, "x85da0fd6.", "prefix x85da0fd6. must match '^e'"},
+		{"Default, wrong end", nil, "e85da0fd6-", "prefix must end with one of '.'"},
+		{"Empty", nil, "", "prefix is empty"},
+		{"Custom", team, "team-orders_", ""},
+		{"Custom, too long", team, "team-ordersandpayments-", "prefix length must be 6 to 20. Found a prefix of length 23"},
+		{"Custom, wrong separator", team, "team-orders.", "prefix must end with one of '-_'"},
+		{"Any", &Policy{}, "x", ""},
+		{"Allow-list", &Policy{Topics: []string{"orders"}}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.prefix)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	assert.NoError(t, Default.Check())
+	assert.NoError(t, (*Policy)(nil).Check())
+	assert.Error(t, (&Policy{Pattern: "("}).Check())
+	assert.Error(t, (&Policy{MinLength: 10, MaxLength: 5}).Check())
+	assert.Error(t, (&Policy{MinLength: 1}).Check())
+	assert.NoError(t, (&Policy{MinLength: ShortestPrefix}).Check())
+	assert.NoError(t, (&Policy{Separators: "-"}).Check())
+	assert.NoError(t, (&Policy{Topics: []string{"orders"}}).Check())
+}
+
+func TestPolicy_Manages(t *testing.T) {
+
+	assert.True(t, Default.Manages("e85da0fd6.", "e85da0fd6.orders"))
+	assert.False(t, Default.Manages("e85da0fd6.", "orders"))
+
+	allowList := &Policy{Topics: []string{"orders", "payments"}}
+	prefix, err := allowList.Resolve("e85da0fd6.")
+	assert.NoError(t, err)
+	assert.Equal(t, "", prefix)
+	assert.True(t, allowList.Manages(prefix, "orders"))
+	assert.False(t, allowList.Manages(prefix, "refunds"))
+}
+
+func TestPolicy_Extract(t *testing.T) {
+
+	tests := []struct {
+		policy *Policy
+		topic  string
+		want   string
+		wantOk bool
+	}{
+		{nil, "e85da0fd6.orders", "e85da0fd6.", true},
+		{nil, "e85da0fd6.orders.v1", "e85da0fd6.", true},
+		{nil, "orders", "", false},
+		{nil, "a.b", "", false},
+		{&Policy{Separators: "._"}, "team_orders.v1", "team_", true},
+		{&Policy{Separators: ".", MinLength: 6}, "a.team.orders", "a.team.", true},
+		{&Policy{}, "e85da0fd6.orders", "", false},
+		{&Policy{Separators: ".", Topics: []string{"e85da0fd6.orders"}}, "e85da0fd6.orders", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.policy.Extract(tt.topic)
+		assert.Equal(t, tt.want, got, tt.topic)
+		assert.Equal(t, tt.wantOk, ok, tt.topic)
+	}
+}
+
+func TestExtractPrefix(t *testing.T) {
+
+	for _, topic := range []string{"", "a", "orders", "__consumer_offsets", "e85da0fd6"} {
+		_, err := ExtractPrefix(topic)
+		assert.Error(t, err, topic)
+		assert.False(t, HasPrefix(topic), topic)
+	}
+
+	prefix, err := ExtractPrefix("e85da0fd6.orders")
+	assert.NoError(t, err)
+	assert.Equal(t, "e85da0fd6.", prefix)
+	assert.True(t, HasPrefix("e85da0fd6.orders"))
+}
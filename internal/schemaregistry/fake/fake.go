@@ -0,0 +1,251 @@
+// Package fake is an in-memory Schema Registry with the API used by the agent: subjects, their
+// latest versions and compatibility configs, registering schemas and soft deleting subjects.
+package fake
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
+	"github.com/gin-gonic/gin"
+)
+
+// Server is a fake Schema Registry. All methods are safe for concurrent use.
+type Server struct {
+	// Username and Password are required as basic auth if Username is set.
+	Username string
+	Password string
+	// Compatibility is the compatibility level of the registry.
+	Compatibility string
+
+	mu            sync.Mutex
+	nextId        int
+	subjects      map[string][]schemaregistry.Schema
+	deleted       map[string]bool
+	compatibility map[string]string
+	failure       int
+}
+
+// New returns an empty registry with BACKWARD compatibility.
+func New() *Server {
+	return &Server{
+		Compatibility: "BACKWARD",
+		subjects:      make(map[string][]schemaregistry.Schema),
+		deleted:       make(map[string]bool),
+		compatibility: make(map[string]string),
+	}
+}
+
+// Register adds the schema as a new version of the subject, unless the subject has it, and returns
+// the version. schemaType is left out of responses for Avro, like the registry does.
+func (s *Server) Register(subject string, schemaType string, schema string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.register(subject, schemaType, schema).Version
+}
+
+func (s *Server) register(subject string, schemaType string, schema string) schemaregistry.Schema {
+
+	if s.deleted[subject] {
+		delete(s.subjects, subject)
+		delete(s.deleted, subject)
+	}
+	for _, version := range s.subjects[subject] {
+		if version.Schema == schema {
+			return version
+		}
+	}
+
+	if schemaType == schemaregistry.Avro {
+		schemaType = ""
+	}
+	s.nextId++
+	version := len(s.subjects[subject]) + 1
+	s.subjects[subject] = append(s.subjects[subject], schemaregistry.Schema{
+		Subject:    subject,
+		Version:    version,
+		Id:         s.nextId,
+		SchemaType: schemaType,
+		Schema:     schema,
+	})
+	return s.subjects[subject][version-1]
+}
+
+// Subjects returns the sorted subjects that are not deleted.
+func (s *Server) Subjects() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.subjectNames()
+}
+
+// Deleted reports whether the subject is soft deleted.
+func (s *Server) Deleted(subject string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleted[subject]
+}
+
+// SubjectCompatibility returns the compatibility level of the subject, empty if it has none.
+func (s *Server) SubjectCompatibility(subject string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compatibility[subject]
+}
+
+// SetCompatibility sets the compatibility level of the subject.
+func (s *Server) SetCompatibility(subject string, level string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compatibility[subject] = level
+}
+
+// Fail makes every request fail with status, until called again with 0.
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failure = status
+}
+
+// Handler returns the HTTP handler of the registry.
+func (s *Server) Handler() http.Handler {
+
+	router := gin.New()
+	router.Use(s.authorize)
+	router.GET("/subjects", s.listSubjects)
+	router.GET("/subjects/:subject/versions/latest", s.getLatest)
+	router.POST("/subjects/:subject/versions", s.registerSchema)
+	router.DELETE("/subjects/:subject", s.deleteSubject)
+	router.GET("/config", s.getConfig)
+	router.GET("/config/:subject", s.getConfig)
+	router.PUT("/config/:subject", s.putConfig)
+	return router
+}
+
+func (s *Server) authorize(c *gin.Context) {
+
+	s.mu.Lock()
+	failure := s.failure
+	s.mu.Unlock()
+
+	if failure != 0 {
+		c.AbortWithStatusJSON(failure, gin.H{"error_code": failure, "message": http.StatusText(failure)})
+		return
+	}
+	if s.Username == "" {
+		return
+	}
+	username, password, ok := c.Request.BasicAuth()
+	if !ok || username != s.Username || password != s.Password {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error_code": 401, "message": "Unauthorized"})
+	}
+}
+
+func (s *Server) listSubjects(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.JSON(http.StatusOK, s.subjectNames())
+}
+
+func (s *Server) subjectNames() []string {
+
+	subjects := make([]string, 0, len(s.subjects))
+	for subject := range s.subjects {
+		if !s.deleted[subject] {
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+func (s *Server) getLatest(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, ok := s.subjects[c.Param("subject")]
+	if !ok || s.deleted[c.Param("subject")] {
+		c.JSON(http.StatusNotFound, gin.H{"error_code": 40401, "message": "Subject not found."})
+		return
+	}
+	c.JSON(http.StatusOK, versions[len(versions)-1])
+}
+
+func (s *Server) registerSchema(c *gin.Context) {
+
+	var request schemaregistry.Schema
+	if err := c.ShouldBindJSON(&request); err != nil || request.Schema == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error_code": 42201, "message": "Invalid schema"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schemaType := request.SchemaType
+	if schemaType == "" {
+		schemaType = schemaregistry.Avro
+	}
+	schema := s.register(c.Param("subject"), schemaType, request.Schema)
+	c.JSON(http.StatusOK, gin.H{"id": schema.Id})
+}
+
+func (s *Server) deleteSubject(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subject := c.Param("subject")
+	versions, ok := s.subjects[subject]
+	if !ok || s.deleted[subject] {
+		c.JSON(http.StatusNotFound, gin.H{"error_code": 40401, "message": "Subject not found."})
+		return
+	}
+	s.deleted[subject] = true
+
+	numbers := make([]int, 0, len(versions))
+	for _, version := range versions {
+		numbers = append(numbers, version.Version)
+	}
+	c.JSON(http.StatusOK, numbers)
+}
+
+func (s *Server) putConfig(c *gin.Context) {
+
+	var request struct {
+		Compatibility string `json:"compatibility"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Compatibility == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error_code": 42203, "message": "Invalid compatibility level"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compatibility[c.Param("subject")] = request.Compatibility
+	c.JSON(http.StatusOK, request)
+}
+
+func (s *Server) getConfig(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subject := c.Param("subject")
+	if subject == "" {
+		c.JSON(http.StatusOK, schemaregistry.Config{CompatibilityLevel: s.Compatibility})
+		return
+	}
+	level, ok := s.compatibility[subject]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error_code": 40408, "message": "Subject does not have subject-level compatibility configured"})
+		return
+	}
+	c.JSON(http.StatusOK, schemaregistry.Config{CompatibilityLevel: level})
+}
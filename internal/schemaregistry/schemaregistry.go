@@ -0,0 +1,281 @@
+// Package schemaregistry is a client of a Confluent compatible Schema Registry.
+package schemaregistry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Schema types. The registry leaves out the type of Avro schemas.
+const (
+	Avro       = "AVRO"
+	JSONSchema = "JSON"
+	Protobuf   = "PROTOBUF"
+)
+
+// Subject name strategies.
+const (
+	// TopicNameStrategy subjects are {topic}-key and {topic}-value.
+	TopicNameStrategy = "topic_name"
+	// TopicRecordNameStrategy subjects are {topic}-{record name}.
+	TopicRecordNameStrategy = "topic_record_name"
+)
+
+// ErrNotFound is returned for subjects, versions and configs the registry does not have.
+var ErrNotFound = errors.New("not found")
+
+// recordName matches the fully-qualified names of Avro and Protobuf records, e.g. com.acme.Order.
+var recordName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// Client of a Schema Registry.
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	// CAFile, CertFile and KeyFile are PEM files for TLS. The system CAs are used without a CAFile,
+	// and a client certificate is only sent with both CertFile and KeyFile.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	resty *resty.Client
+}
+
+// Schema is a version of the schema of a subject.
+type Schema struct {
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	Id         int    `json:"id"`
+	SchemaType string `json:"schemaType,omitempty"`
+	Schema     string `json:"schema"`
+}
+
+// Type returns the schema type, Avro if the registry left it out.
+func (s *Schema) Type() string {
+	if s.SchemaType == "" {
+		return Avro
+	}
+	return s.SchemaType
+}
+
+// Config is the compatibility config of a subject or of the registry.
+type Config struct {
+	CompatibilityLevel string `json:"compatibilityLevel"`
+}
+
+type errorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (c *Client) restyClient() (*resty.Client, error) {
+
+	if c.resty != nil {
+		return c.resty, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" && c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	c.resty = resty.New().
+		SetBaseURL(strings.TrimSuffix(c.URL, "/")).
+		SetTimeout(30*time.Second).
+		SetTLSClientConfig(tlsConfig).
+		SetHeader("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if c.Username != "" {
+		c.resty.SetBasicAuth(c.Username, c.Password)
+	}
+	return c.resty, nil
+}
+
+// do performs a request to path with body, if not nil, and parses the response into result.
+func (c *Client) do(ctx context.Context, method string, path string, body any, result any) error {
+
+	ctx, span := tracing.Start(ctx, "schema registry "+method,
+		attribute.String("http.method", method),
+		attribute.String("http.url", c.URL+path),
+	)
+
+	client, err := c.restyClient()
+	if err != nil {
+		tracing.End(span, err)
+		return err
+	}
+
+	log.Logger.Debugf("Performing %s to: %s%s", method, c.URL, path)
+	var failure errorResponse
+	request := client.R().SetContext(ctx).SetResult(result).SetError(&failure)
+	if body != nil {
+		request.SetHeader("Content-Type", "application/vnd.schemaregistry.v1+json").SetBody(body)
+	}
+	response, err := request.Execute(method, path)
+	if err != nil {
+		tracing.End(span, err)
+		return err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", response.StatusCode()))
+
+	if response.StatusCode() == http.StatusNotFound {
+		err = fmt.Errorf("%s %s: %w", method, path, ErrNotFound)
+	} else if response.IsError() {
+		err = fmt.Errorf("%s %s: %s: %s", method, path, response.Status(), failure.Message)
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// get performs a GET request to path and parses the response into result.
+func (c *Client) get(ctx context.Context, path string, result any) error {
+	return c.do(ctx, http.MethodGet, path, nil, result)
+}
+
+// Subjects returns the sorted subjects of the registry.
+func (c *Client) Subjects(ctx context.Context) ([]string, error) {
+
+	var subjects []string
+	err := c.get(ctx, "/subjects", &subjects)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+// Latest returns the latest version of the schema of the subject.
+func (c *Client) Latest(ctx context.Context, subject string) (*Schema, error) {
+
+	var schema Schema
+	err := c.get(ctx, fmt.Sprintf("/subjects/%s/versions/latest", url.PathEscape(subject)), &schema)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Compatibility returns the compatibility level of the subject, or of the registry if the subject has none.
+func (c *Client) Compatibility(ctx context.Context, subject string) (string, error) {
+
+	var config Config
+	err := c.get(ctx, fmt.Sprintf("/config/%s", url.PathEscape(subject)), &config)
+	if errors.Is(err, ErrNotFound) {
+		err = c.get(ctx, "/config", &config)
+	}
+	if err != nil {
+		return "", err
+	}
+	return config.CompatibilityLevel, nil
+}
+
+// Register registers the schema as the next version of the subject and returns its id. Registering
+// a schema the subject already has returns the id of the existing version.
+func (c *Client) Register(ctx context.Context, subject string, schemaType string, schema string) (int, error) {
+
+	if schemaType == Avro {
+		schemaType = ""
+	}
+	var registered struct {
+		Id int `json:"id"`
+	}
+	body := struct {
+		SchemaType string `json:"schemaType,omitempty"`
+		Schema     string `json:"schema"`
+	}{schemaType, schema}
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject)), &body, &registered)
+	if err != nil {
+		return 0, err
+	}
+	return registered.Id, nil
+}
+
+// SetCompatibility sets the compatibility level of the subject.
+func (c *Client) SetCompatibility(ctx context.Context, subject string, level string) error {
+
+	var config struct {
+		Compatibility string `json:"compatibility"`
+	}
+	config.Compatibility = level
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/config/%s", url.PathEscape(subject)), &config, &config)
+}
+
+// DeleteSubject soft deletes all versions of the subject. They can be restored by the registry,
+// until they are deleted permanently.
+func (c *Client) DeleteSubject(ctx context.Context, subject string) error {
+
+	var versions []int
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/subjects/%s", url.PathEscape(subject)), nil, &versions)
+}
+
+// Subjects returns the subjects of the topic among subjects, with the role of each subject: key or value
+// for TopicNameStrategy, the record name for TopicRecordNameStrategy, and for templates like {topic}-value
+// what is left of the subject without the topic. Templates are used instead of the strategy if given.
+// Record names are fully-qualified names without a '-', so the subjects of a topic named like orders-archive
+// are never taken for records of orders.
+func Subjects(topic string, subjects []string, strategy string, templates []string) map[string]string {
+
+	available := make(map[string]bool)
+	for _, subject := range subjects {
+		available[subject] = true
+	}
+
+	found := make(map[string]string)
+	switch {
+	case len(templates) > 0:
+		for _, template := range templates {
+			subject := strings.ReplaceAll(template, "{topic}", topic)
+			if available[subject] {
+				role := strings.Trim(strings.Replace(subject, topic, "", 1), "-._:")
+				if role == "" {
+					role = "value"
+				}
+				found[subject] = role
+			}
+		}
+	case strategy == TopicRecordNameStrategy:
+		for _, subject := range subjects {
+			record := strings.TrimPrefix(subject, topic+"-")
+			if record != subject && record != "key" && record != "value" && recordName.MatchString(record) {
+				found[subject] = record
+			}
+		}
+	default:
+		for _, role := range []string{"key", "value"} {
+			if subject := topic + "-" + role; available[subject] {
+				found[subject] = role
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,105 @@
+package schemaregistry_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry/fake"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	registry := fake.New()
+	registry.Username = "user"
+	registry.Password = "secret"
+	registry.Register("orders-value", schemaregistry.Avro, `{"type":"string"}`)
+	registry.Register("orders-value", schemaregistry.Avro, `{"type":"long"}`)
+	registry.Register("payments-value", schemaregistry.Protobuf, `syntax = "proto3";`)
+	registry.SetCompatibility("payments-value", "FULL")
+
+	srv := httptest.NewServer(registry.Handler())
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := (&schemaregistry.Client{URL: srv.URL}).Subjects(ctx)
+	assert.Error(t, err)
+
+	client := &schemaregistry.Client{URL: srv.URL + "/", Username: "user", Password: "secret"}
+
+	subjects, err := client.Subjects(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders-value", "payments-value"}, subjects)
+
+	schema, err := client.Latest(ctx, "orders-value")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, schema.Version)
+	assert.Equal(t, schemaregistry.Avro, schema.Type())
+	assert.Equal(t, `{"type":"long"}`, schema.Schema)
+
+	_, err = client.Latest(ctx, "unknown-value")
+	assert.ErrorIs(t, err, schemaregistry.ErrNotFound)
+
+	compatibility, err := client.Compatibility(ctx, "orders-value")
+	assert.NoError(t, err)
+	assert.Equal(t, "BACKWARD", compatibility)
+
+	compatibility, err = client.Compatibility(ctx, "payments-value")
+	assert.NoError(t, err)
+	assert.Equal(t, "FULL", compatibility)
+
+	id, err := client.Register(ctx, "refunds-value", schemaregistry.JSONSchema, `{"type":"object"}`)
+	assert.NoError(t, err)
+	again, err := client.Register(ctx, "refunds-value", schemaregistry.JSONSchema, `{"type":"object"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+	schema, err = client.Latest(ctx, "refunds-value")
+	assert.NoError(t, err)
+	assert.Equal(t, schemaregistry.JSONSchema, schema.Type())
+
+	assert.NoError(t, client.SetCompatibility(ctx, "refunds-value", "FORWARD"))
+	assert.Equal(t, "FORWARD", registry.SubjectCompatibility("refunds-value"))
+
+	assert.NoError(t, client.DeleteSubject(ctx, "refunds-value"))
+	assert.True(t, registry.Deleted("refunds-value"))
+	assert.ErrorIs(t, client.DeleteSubject(ctx, "refunds-value"), schemaregistry.ErrNotFound)
+	subjects, err = client.Subjects(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders-value", "payments-value"}, subjects)
+
+	registry.Fail(http.StatusInternalServerError)
+	_, err = client.Subjects(ctx)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, schemaregistry.ErrNotFound)
+}
+
+func TestSubjects(t *testing.T) {
+
+	subjects := []string{"orders-key", "orders-value", "orders-com.acme.Created", "orders.v2-value", "orders.avro"}
+
+	assert.Equal(t, map[string]string{"orders-key": "key", "orders-value": "value"},
+		schemaregistry.Subjects("orders", subjects, schemaregistry.TopicNameStrategy, nil))
+	assert.Equal(t, map[string]string{"orders-com.acme.Created": "com.acme.Created"},
+		schemaregistry.Subjects("orders", subjects, schemaregistry.TopicRecordNameStrategy, nil))
+	assert.Equal(t, map[string]string{"orders.avro": "avro"},
+		schemaregistry.Subjects("orders", subjects, schemaregistry.TopicNameStrategy, []string{"{topic}.avro", "{topic}.json"}))
+	assert.Empty(t, schemaregistry.Subjects("payments", subjects, schemaregistry.TopicNameStrategy, nil))
+}
+
+func TestSubjects_PrefixOfOtherTopic(t *testing.T) {
+
+	// e1.orders is a prefix of e1.orders-archive, whose subjects are not those of e1.orders.
+	subjects := []string{"e1.orders-com.acme.Order", "e1.orders-archive-com.acme.Order", "e1.orders-archive-value", "e1.orders-archive-key"}
+
+	assert.Equal(t, map[string]string{"e1.orders-com.acme.Order": "com.acme.Order"},
+		schemaregistry.Subjects("e1.orders", subjects, schemaregistry.TopicRecordNameStrategy, nil))
+	assert.Equal(t, map[string]string{"e1.orders-archive-com.acme.Order": "com.acme.Order"},
+		schemaregistry.Subjects("e1.orders-archive", subjects, schemaregistry.TopicRecordNameStrategy, nil))
+	assert.Empty(t, schemaregistry.Subjects("e1.orders", subjects, schemaregistry.TopicNameStrategy, nil))
+}
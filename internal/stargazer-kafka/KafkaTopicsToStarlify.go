@@ -2,53 +2,62 @@ package stargazer_kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/entiros/stargazer-kafka/internal/audit"
 	"github.com/entiros/stargazer-kafka/internal/kafka"
 	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/mapping"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
 	pre "github.com/entiros/stargazer-kafka/internal/prefix"
 	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
+	"github.com/entiros/stargazer-kafka/internal/webhook"
 	"github.com/twmb/franz-go/pkg/kadm"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
 	"sort"
-	"strings"
+	"sync"
+	"time"
 )
 
 type KafkaTopicsToStarlify struct {
-	starlify                *starlify.Client
-	kafka                   *kafka.Client
-	lastUpdateReportedError bool
+	name       string
+	starlify   *starlify.Client
+	kafka      kafka.Admin
+	mapping    *mapping.Rules
+	prefix     *pre.Policy
+	schemas    *Schemas
+	sampling   *Sampling
+	audit      *audit.Trail
+	notifier   *webhook.Notifier
+	attributes bool
 }
 
 const KafkaType = "managed-kafka"
 
-func InitKafkaTopicsToStarlify(ctx context.Context, kafkaClient *kafka.Client, starlify *starlify.Client) (*KafkaTopicsToStarlify, error) {
+// InitKafkaTopicsToStarlify creates the integration for the system called name.
+func InitKafkaTopicsToStarlify(ctx context.Context, name string, kafkaClient kafka.Admin, starlify *starlify.Client) (*KafkaTopicsToStarlify, error) {
 	// Get agent from Starlify and verify type
 	agent, err := starlify.GetAgent(ctx)
 	if err != nil {
-		return nil, err
+		return nil, NewError(StarlifyError, err)
 	} else if agent.AgentType != KafkaType {
-		return nil, fmt.Errorf("starlify agent '%s' is of type '%s', expected '%s'", agent.Id, agent.AgentType, KafkaType)
+		return nil, NewError(ConfigError, fmt.Errorf("starlify agent '%s' is of type '%s', expected '%s'", agent.Id, agent.AgentType, KafkaType))
 	}
 
 	kafkaTopicsToStarlify := KafkaTopicsToStarlify{
-		starlify:                starlify,
-		kafka:                   kafkaClient,
-		lastUpdateReportedError: false,
+		name:     name,
+		starlify: starlify,
+		kafka:    kafkaClient,
 	}
 
 	return &kafkaTopicsToStarlify, nil
 }
 
-// reportError will send error message to Starlify and mark last update to have reported error.
-func (k *KafkaTopicsToStarlify) ReportError(ctx context.Context, message error) {
-	log.Logger.Debug(message)
-
-	// // Report error
-	err := k.starlify.ReportError(ctx, message.Error())
-	if err != nil {
-		log.Logger.Debugf("Failed to report error: %v", err)
-	} else {
-		k.lastUpdateReportedError = true
-	}
+// SetAttributes turns reporting of topic attributes on endpoints on or off.
+func (k *KafkaTopicsToStarlify) SetAttributes(enabled bool) {
+	k.attributes = enabled
 }
 
 func (k *KafkaTopicsToStarlify) Ping(ctx context.Context) error {
@@ -59,11 +68,94 @@ func (k *KafkaTopicsToStarlify) Ping(ctx context.Context) error {
 	return err
 }
 
+// getStarlifyTopics returns the prefix resolved by the prefix policy and the endpoints whose mapped topic
+// is managed under the prefix, with Topic set.
+// Endpoints that can't be mapped to a valid topic name, or to a topic another endpoint is mapped to, are left
+// out, and make the listing incomplete: their topics must not be deleted.
 func (k *KafkaTopicsToStarlify) getStarlifyTopics(ctx context.Context) (string, []starlify.TopicEndpoint, error) {
 
 	log.Logger.Debugf("Getting Starlify topics")
-	return k.starlify.GetTopics(ctx)
+	prefix, endpoints, err := k.starlify.GetMiddlewareTopics(ctx)
+	if err != nil && !errors.Is(err, starlify.ErrIncomplete) {
+		return "", nil, NewError(StarlifyError, err)
+	}
+	prefix, prefixErr := k.prefix.Resolve(prefix)
+	if prefixErr != nil {
+		return "", nil, NewError(ConfigError, prefixErr)
+	}
+
+	var topics []starlify.TopicEndpoint
+	var skipped []string
+	mapped := make(map[string]string)
+	for _, endpoint := range endpoints {
+		topic, mapErr := k.mapping.ToTopic(prefix, endpoint.Name, attributeValues(endpoint.Attributes))
+		if mapErr != nil && (topic == "" || k.prefix.Manages(prefix, topic)) {
+			log.Ctx(ctx).Errorf("Skipping endpoint %s: %v", endpoint.Name, mapErr)
+			skipped = append(skipped, endpoint.Name)
+			continue
+		}
+		if !k.prefix.Manages(prefix, topic) {
+			continue
+		}
+		if other, ok := mapped[topic]; ok {
+			log.Ctx(ctx).Errorf("Skipping endpoint %s: endpoint %s is already mapped to topic %s", endpoint.Name, other, topic)
+			skipped = append(skipped, endpoint.Name)
+			continue
+		}
+		mapped[topic] = endpoint.Name
+		endpoint.Topic = topic
+		topics = append(topics, endpoint)
+	}
+	if err != nil {
+		return prefix, topics, NewError(StarlifyError, err)
+	}
+	if len(skipped) > 0 {
+		return prefix, topics, NewError(ConfigError, &UnmappedError{Endpoints: skipped})
+	}
+	return prefix, topics, nil
+
+}
+
+// SetMapping sets the rules mapping endpoint names to topic names. Nil rules use endpoint names as topic names.
+func (k *KafkaTopicsToStarlify) SetMapping(rules *mapping.Rules) {
+	k.mapping = rules
+}
 
+// SetPrefixPolicy sets the policy for the Kafka prefix of the middleware. A nil policy is prefix.Default.
+func (k *KafkaTopicsToStarlify) SetPrefixPolicy(policy *pre.Policy) {
+	k.prefix = policy
+}
+
+// endpointName returns the endpoint name and attributes for the topic, or false if the topic can't be
+// mapped back to the same topic.
+func (k *KafkaTopicsToStarlify) endpointName(ctx context.Context, prefix string, topic string) (string, map[string]string, bool) {
+
+	name, variables, ok := k.mapping.ToEndpoint(prefix, topic)
+	if !ok {
+		log.Ctx(ctx).Debugf("Skipping topic %s, it does not match the topic name template", topic)
+		return "", nil, false
+	}
+	if mapped, err := k.mapping.ToTopic(prefix, name, variables); err != nil || mapped != topic {
+		log.Ctx(ctx).Errorf("Skipping topic %s, endpoint %s would map to topic %s", topic, name, mapped)
+		return "", nil, false
+	}
+	return name, variables, true
+}
+
+// warnCollisions logs topics that only differ in '.' and '_'.
+func warnCollisions(ctx context.Context, topics []string) {
+	for _, collision := range mapping.Collisions(topics) {
+		log.Ctx(ctx).Infof("Topics %v only differ in '.' and '_', their metric names collide", collision)
+	}
+}
+
+func attributeValues(attributes []starlify.Attribute) map[string]string {
+
+	values := make(map[string]string)
+	for _, attribute := range attributes {
+		values[attribute.Name] = attribute.Value
+	}
+	return values
 }
 
 // get topics(endpoints on a middleware) from Starlify and create matching topics in Kafka.
@@ -71,19 +163,19 @@ func (k *KafkaTopicsToStarlify) SyncTopicsToKafka(ctx context.Context) (string,
 
 	// Get topics (endpoints) for this specific Middleware
 	prefix, topics, err := k.getStarlifyTopics(ctx)
-	if err != nil {
+	incomplete := errors.Is(err, starlify.ErrIncomplete)
+	if err != nil && !incomplete {
 		return "", err
 	}
+	listErr := err
 
 	var starlifyTopics []string
 	for _, topic := range topics {
-		starlifyTopics = append(starlifyTopics, topic.Name)
+		starlifyTopics = append(starlifyTopics, topic.Topic)
 	}
+	warnCollisions(ctx, starlifyTopics)
 
-	log.Logger.Debugf("Prefix is: %s", prefix)
-	if prefix == "" || len(prefix) < 8 {
-		return "", fmt.Errorf("invalid prefix: %s", prefix)
-	}
+	log.Ctx(ctx).Debugf("Prefix is: %s", prefix)
 
 	// Get all Kafka topics with the specified prefix. Prefix is from Starlify middleware.
 	kafkaTopics, err := k.getKafkaTopics(ctx, prefix)
@@ -91,19 +183,65 @@ func (k *KafkaTopicsToStarlify) SyncTopicsToKafka(ctx context.Context) (string,
 		return "", err
 	}
 
-	createMe, deleteMe := ListDiff(kafkaTopics, starlifyTopics)
+	createMe, deleteMe := diff(ctx, kafkaTopics, starlifyTopics)
+	changes := &audit.Diff{Create: createMe, Delete: deleteMe}
 
-	log.Logger.Debugf("Creating topics: %v", createMe)
-	err = k.kafka.CreateTopics(ctx, createMe...)
+	log.Ctx(ctx).Debugf("Creating topics: %v", createMe)
+	results, err := k.kafka.CreateTopics(ctx, createMe...)
 	if err != nil {
-		return "", err
+		return "", NewError(KafkaError, err)
 	}
+	created := results.Succeeded()
+	metrics.TopicsCreated.WithLabelValues(k.name, prefix).Add(float64(len(created)))
 
-	log.Logger.Debugf("Deleting topics: %v", deleteMe)
-	err = k.kafka.DeleteTopics(ctx, deleteMe...)
+	endpoints := make(map[string]starlify.TopicEndpoint)
+	for _, topic := range topics {
+		endpoints[topic.Topic] = topic
+	}
+	var events []audit.Event
+	for _, topic := range created {
+		events = append(events, audit.Event{Action: audit.TopicCreate, Target: topic, Diff: changes,
+			After: &audit.State{Name: topic, Endpoint: endpoints[topic].Name}})
+	}
+	k.record(ctx, prefix, events...)
+	k.notify(webhook.TopicsCreated, prefix, created)
+
+	// Only the topics the cluster created are recorded, and nothing is deleted if it refused any.
+	if err := results.Err(); err != nil {
+		k.updateSubjects(ctx, prefix, topics, created, nil)
+		return "", NewError(KafkaError, fmt.Errorf("failed to create topics. %v", err))
+	}
+
+	// Topics missing from an incomplete listing must not be deleted.
+	if incomplete {
+		log.Ctx(ctx).Errorf("Not deleting topics %v, Starlify endpoints are incomplete: %v", deleteMe, listErr)
+		k.notifyBlocked(prefix, deleteMe, listErr)
+		k.updateSubjects(ctx, prefix, topics, created, nil)
+		return prefix, listErr
+	}
+
+	log.Ctx(ctx).Debugf("Deleting topics: %v", deleteMe)
+	results, err = k.kafka.DeleteTopics(ctx, deleteMe...)
 	if err != nil {
-		return "", err
+		return "", NewError(KafkaError, err)
 	}
+	deleted := results.Succeeded()
+	metrics.TopicsDeleted.WithLabelValues(k.name, prefix).Add(float64(len(deleted)))
+
+	events = nil
+	for _, topic := range deleted {
+		events = append(events, audit.Event{Action: audit.TopicDelete, Target: topic, Diff: changes,
+			Before: &audit.State{Name: topic}})
+	}
+	k.record(ctx, prefix, events...)
+	k.notify(webhook.TopicsDeleted, prefix, deleted)
+
+	k.updateSubjects(ctx, prefix, topics, created, deleted)
+
+	if err := results.Err(); err != nil {
+		return "", NewError(KafkaError, fmt.Errorf("failed to delete topics. %v", err))
+	}
+	metrics.TopicsUnderPrefix.WithLabelValues(k.name, prefix).Set(float64(len(starlifyTopics)))
 
 	return prefix, nil
 }
@@ -111,8 +249,11 @@ func (k *KafkaTopicsToStarlify) SyncTopicsToKafka(ctx context.Context) (string,
 // get topics from Kafka and create matching topics in Starlify.
 func (k *KafkaTopicsToStarlify) SyncTopicsToStarlify(ctx context.Context) (string, error) {
 
+	// Endpoints missing from an incomplete listing would be created again, and
+	// the endpoints to delete can't be known. Endpoints that can't be mapped are left as they are.
 	prefix, topics, err := k.getStarlifyTopics(ctx)
-	if err != nil {
+	var unmapped *UnmappedError
+	if err != nil && !errors.As(err, &unmapped) {
 		return "", err
 	}
 
@@ -120,8 +261,8 @@ func (k *KafkaTopicsToStarlify) SyncTopicsToStarlify(ctx context.Context) (strin
 	topicEndpoints := make(map[string]starlify.TopicEndpoint)
 
 	for _, topic := range topics {
-		starlifyTopics = append(starlifyTopics, topic.Name)
-		topicEndpoints[topic.Name] = topic
+		starlifyTopics = append(starlifyTopics, topic.Topic)
+		topicEndpoints[topic.Topic] = topic
 	}
 
 	kafkaTopics, err := k.getKafkaTopics(ctx, prefix)
@@ -129,49 +270,128 @@ func (k *KafkaTopicsToStarlify) SyncTopicsToStarlify(ctx context.Context) (strin
 		return "", err
 	}
 
-	createMe, deleteMe := ListDiff(starlifyTopics, kafkaTopics)
+	createMe, deleteMe := diff(ctx, starlifyTopics, kafkaTopics)
+	changes := &audit.Diff{Create: createMe, Delete: deleteMe}
 
-	log.Logger.Debugf("Creating topics: %v", createMe)
-	for _, topic := range createMe {
-		err = k.starlify.CreateTopic(ctx, topic)
+	var attributes map[string][]starlify.Attribute
+	if k.attributes {
+		attributes, err = k.getTopicAttributes(ctx, kafkaTopics)
 		if err != nil {
 			return "", err
 		}
+		k.addSchemaAttributes(ctx, topics, kafkaTopics, attributes)
+		k.addPayloadAttributes(ctx, topics, kafkaTopics, attributes)
+	}
+
+	log.Ctx(ctx).Debugf("Creating topics: %v", createMe)
+	var mu sync.Mutex
+	var created []string
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(k.starlify.Concurrency())
+	for _, topic := range createMe {
+		topic := topic
+		name, variables, ok := k.endpointName(ctx, prefix, topic)
+		if !ok {
+			continue
+		}
+		group.Go(func() error {
+			endpointAttributes := variableAttributes(variables)
+			if topicAttributes, ok := attributes[topic]; ok {
+				endpointAttributes = mergeAttributes(endpointAttributes, topicAttributes, time.Now())
+			}
+			err := k.starlify.CreateTopic(groupCtx, name, endpointAttributes...)
+			if errors.Is(err, starlify.ErrConflict) {
+				log.Ctx(ctx).Debugf("Endpoint %s already exists", name)
+				return nil
+			}
+			if err != nil {
+				return NewError(StarlifyError, err)
+			}
+			metrics.TopicsCreated.WithLabelValues(k.name, prefix).Inc()
+			k.record(ctx, prefix, audit.Event{Action: audit.EndpointCreate, Target: name, Diff: changes,
+				After: endpointState("", name, topic, endpointAttributes)})
+			mu.Lock()
+			created = append(created, name)
+			mu.Unlock()
+			return nil
+		})
+	}
+	err = group.Wait()
+	sort.Strings(created)
+	k.notify(webhook.EndpointsCreated, prefix, created)
+	if err != nil {
+		return "", err
 	}
 
-	log.Logger.Debugf("Deleting topics: %v", deleteMe)
+	log.Ctx(ctx).Debugf("Deleting topics: %v", deleteMe)
+	var deleted []string
 	for _, topic := range deleteMe {
-		err = k.starlify.DeleteTopic(ctx, topicEndpoints[topic])
+		endpoint := topicEndpoints[topic]
+		err = k.starlify.DeleteTopic(ctx, endpoint)
+		if errors.Is(err, starlify.ErrNotFound) {
+			log.Ctx(ctx).Debugf("Endpoint %s already deleted", topic)
+			continue
+		}
 		if err != nil {
-			return "", err
+			k.notify(webhook.EndpointsDeleted, prefix, deleted)
+			return "", NewError(StarlifyError, err)
 		}
+		metrics.TopicsDeleted.WithLabelValues(k.name, prefix).Inc()
+		k.record(ctx, prefix, audit.Event{Action: audit.EndpointDelete, Target: endpoint.Name, Diff: changes,
+			Before: endpointState(endpoint.ID, endpoint.Name, topic, endpoint.Attributes)})
+		deleted = append(deleted, endpoint.Name)
+	}
+	k.notify(webhook.EndpointsDeleted, prefix, deleted)
+	metrics.TopicsUnderPrefix.WithLabelValues(k.name, prefix).Set(float64(len(kafkaTopics)))
+
+	err = k.updateAttributes(ctx, prefix, topics, attributes)
+	if err != nil {
+		return "", err
 	}
+
 	return prefix, nil
 }
 
 func (k *KafkaTopicsToStarlify) getKafkaTopics(ctx context.Context, prefix string) ([]string, error) {
 
-	if err := pre.Validate(prefix); err != nil {
-		return nil, err
+	if err := k.prefix.Validate(prefix); err != nil {
+		return nil, NewError(ConfigError, err)
 	}
 
-	topics, err := k.kafka.GetTopics(ctx)
+	names, err := k.kafka.GetTopicNames(ctx, prefix)
 	if err != nil {
 		err = fmt.Errorf("failed to get topics from Kafka with error: %v", err.Error())
-		return nil, err
+		return nil, NewError(KafkaError, err)
 	}
 
 	var kafkaTopics []string
-	for _, t := range topics {
-		if strings.HasPrefix(t.Topic, prefix) {
-			kafkaTopics = append(kafkaTopics, t.Topic)
+	for _, name := range names {
+		if k.prefix.Manages(prefix, name) {
+			kafkaTopics = append(kafkaTopics, name)
 		}
 	}
-	log.Logger.Debugf("%d topics received from Kafka: %v", len(kafkaTopics), kafkaTopics)
+	log.Ctx(ctx).Debugf("%d topics received from Kafka: %v", len(kafkaTopics), kafkaTopics)
 
 	return kafkaTopics, nil
 }
 
+// diff is ListDiff traced as its own step.
+func diff(ctx context.Context, source []string, target []string) ([]string, []string) {
+
+	_, span := tracing.Start(ctx, "diff",
+		attribute.Int("diff.source", len(source)),
+		attribute.Int("diff.target", len(target)),
+	)
+	defer span.End()
+
+	inserts, deletes := ListDiff(source, target)
+	span.SetAttributes(
+		attribute.Int("diff.inserts", len(inserts)),
+		attribute.Int("diff.deletes", len(deletes)),
+	)
+	return inserts, deletes
+}
+
 // createTopicDetails will return topic details in Starlify format.
 func createTopicDetails(topics kadm.TopicDetails) []starlify.TopicDetails {
 
@@ -1,12 +1,23 @@
 package stargazer_kafka
 
 import (
+	"context"
+	"errors"
 	"github.com/entiros/stargazer-kafka/internal/config"
+	"net/http"
+	"net/http/httptest"
 	"sort"
 	"testing"
+	"time"
 
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/entiros/stargazer-kafka/internal/mapping"
+	pre "github.com/entiros/stargazer-kafka/internal/prefix"
 	"github.com/entiros/stargazer-kafka/internal/starlify"
-	"gopkg.in/h2non/gock.v1"
+	starlifyfake "github.com/entiros/stargazer-kafka/internal/starlify/fake"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -37,116 +48,218 @@ func TestSyncList(t *testing.T) {
 
 }
 
-func createStarlifyClient() *starlify.Client {
-	starlifyClient := &starlify.Client{
-		BaseUrl:      "http://127.0.0.1:8080/hypermedia",
-		ApiKey:       "api-key-123",
-		AgentId:      "agent-id-123",
-		MiddlewareId: "system-id-123",
+const (
+	prefix       = "e12345678."
+	agentId      = "agent-id-123"
+	middlewareId = "system-id-123"
+)
+
+// newSync returns a sync of a fake Kafka cluster with the topics and a fake Starlify with the endpoints.
+func newSync(t *testing.T, topics []string, endpoints []string) (*KafkaTopicsToStarlify, *fake.Cluster, *starlifyfake.Server) {
+
+	gin.SetMode(gin.TestMode)
+
+	s := starlifyfake.New("api-key-123")
+	s.AddMiddleware(middlewareId, "Kafka", prefix)
+	s.AddAgent(agentId, KafkaType, middlewareId)
+	for _, endpoint := range endpoints {
+		_, err := s.AddEndpoint(middlewareId, endpoint)
+		assert.NoError(t, err)
 	}
 
-	// Intercept Starlify client
-	gock.InterceptClient(starlifyClient.GetRestyClient().GetClient())
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
 
-	return starlifyClient
+	cluster := fake.New(topics...)
+	k, err := InitKafkaTopicsToStarlify(context.Background(), t.Name(), cluster, &starlify.Client{
+		BaseUrl:      srv.URL + starlifyfake.BasePath,
+		ApiKey:       "api-key-123",
+		AgentId:      agentId,
+		MiddlewareId: middlewareId,
+		Retry:        &starlify.RetryPolicy{MaxRetries: 1, Timeout: time.Second},
+	})
+	assert.NoError(t, err)
+
+	return k, cluster, s
 }
 
-func createGock() *gock.Request {
-	return gock.New("http://127.0.0.1:8080/hypermedia")
+func TestInitKafkaTopicsToStarlify_WrongAgentType(t *testing.T) {
+
+	s := starlifyfake.New("")
+	s.AddAgent(agentId, "other", middlewareId)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	_, err := InitKafkaTopicsToStarlify(context.Background(), t.Name(), fake.New(), &starlify.Client{
+		BaseUrl: srv.URL + starlifyfake.BasePath,
+		AgentId: agentId,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, ConfigError, Category(err))
 }
 
-/*
-func TestKafkaTopicsToStarlify_createKafkaTopicsToStarlify(t *testing.T) {
-	defer gock.Off()
+func TestSyncTopicsToKafka(t *testing.T) {
 
-	starlifyClient := createStarlifyClient()
+	k, cluster, _ := newSync(t,
+		[]string{prefix + "orders", prefix + "stale", "e87654321.other", "unrelated"},
+		[]string{prefix + "orders", prefix + "payments", "e87654321.foreign"},
+	)
 
-	kafkaTopicsToStarlify := KafkaTopicsToStarlify{
-		starlify:                starlifyClient,
-		topicsCache:             make(map[string]bool),
-		lastUpdateReportedError: false,
-	}
+	p, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, prefix, p)
 
-	createServiceRequest := createGock().
-		Post("/systems/system-id-123/services")
+	// Endpoints not under the prefix are ignored, topics not under the prefix are left alone.
+	assert.Equal(t, []string{prefix + "orders", prefix + "payments", "e87654321.other", "unrelated"}, cluster.Topics())
 
-	// For first execution, no topics is available
-	kafkaTopicsToStarlify.createTopics(func() (map[string]kafka.TopicMetadata, error) {
-		return map[string]kafka.TopicMetadata{}, nil
-	})
+	// A second sync has nothing to do.
+	_, err = k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cluster.Calls(fake.CreateTopics))
+	assert.Equal(t, 1, cluster.Calls(fake.DeleteTopics))
+}
+
+func TestSyncTopicsToKafka_Errors(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		operation string
+		category  string
+		topics    []string
+	}{
+		{"List topics", fake.GetTopicNames, KafkaError, []string{prefix + "orders"}},
+		{"Create topics", fake.CreateTopics, KafkaError, nil},
+		{"Delete topics", fake.DeleteTopics, KafkaError, []string{prefix + "orders", prefix + "stale"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, cluster, _ := newSync(t, tt.topics, []string{prefix + "orders"})
+			cluster.Fail(tt.operation, errors.New("broker unavailable"))
 
-	// No calls to POST services should have been made
-	assert.True(t, gock.IsPending())
-	gock.Remove(createServiceRequest.Mock)
-
-	// 'Topic 1' is already existing in Starlify
-	createGock().
-		Get("/systems/system-id-123/services").
-		Reply(200).
-		JSON(starlify.ServicesPage{
-			Services: []starlify.Service{
-				{Id: "service-1", Name: "Topic_1"},
-			},
-			Page: starlify.Page{
-				Size:          100,
-				TotalElements: 1,
-				TotalPages:    1,
-				Number:        0,
-			},
+			_, err := k.SyncTopicsToKafka(context.Background())
+			assert.Error(t, err)
+			assert.Equal(t, tt.category, Category(err))
 		})
+	}
+}
 
-	// 'Topic 2' will be created
-	createGock().
-		Post("/systems/system-id-123/services").
-		MatchType("json").
-		JSON(starlify.ServiceRequest{Name: "Topic_2"}).
-		Reply(201).
-		JSON(starlify.Service{Id: "service-1", Name: "Topic_2"})
-
-	// Details will be updated
-	createGock().
-		Patch("/agents/agent-id-123").
-		MatchType("json").
-		JSON(starlify.AgentRequest{
-			Error: "",
-			Details: &starlify.Details{
-				Topics: []starlify.TopicDetails{
-					{
-						Name:       "Topic_1",
-						Partitions: []starlify.PartitionDetails{{ID: 0}},
-					},
-					{
-						Name:       "Topic_2",
-						Partitions: []starlify.PartitionDetails{{ID: 0}},
-					},
-				},
-			},
-		}).
-		Reply(200).
-		JSON(starlify.Agent{Id: "agent-id-123", Name: "Test agent", AgentType: "kafka"})
-
-	// Run with two topics available in Kafka
-	kafkaTopicsToStarlify.createTopics(func() (map[string]kafka.TopicMetadata, error) {
-		return map[string]kafka.TopicMetadata{
-			"Topic_1": {
-				Topic: "Topic_1",
-				Partitions: []kafka.PartitionMetadata{
-					{
-						ID: 0,
-					},
-				},
-			},
-			"Topic_2": {
-				Topic: "Topic_2",
-				Partitions: []kafka.PartitionMetadata{
-					{
-						ID: 0,
-					},
-				},
-			},
-		}, nil
-	})
+func TestSyncTopicsToKafka_StarlifyUnavailable(t *testing.T) {
+
+	k, cluster, _ := newSync(t, []string{prefix + "orders"}, nil)
+	k.starlify.ApiKey = "revoked"
+
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.ErrorIs(t, err, starlify.ErrUnauthorized)
+	assert.Equal(t, StarlifyError, Category(err))
+
+	// Nothing is deleted when Starlify can't be read.
+	assert.Equal(t, []string{prefix + "orders"}, cluster.Topics())
+	assert.Equal(t, 0, cluster.Calls(fake.DeleteTopics))
+}
+
+func TestSyncTopicsToStarlify(t *testing.T) {
+
+	k, _, s := newSync(t,
+		[]string{prefix + "orders", prefix + "payments", prefix + "refunds", "e87654321.other"},
+		[]string{prefix + "orders", prefix + "stale", "e87654321.foreign"},
+	)
+	k.starlify.MaxConcurrent = 2
+
+	p, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, prefix, p)
+	assert.Equal(t, []string{prefix + "orders", prefix + "payments", prefix + "refunds", "e87654321.foreign"}, s.Endpoints(middlewareId))
+
+	// A second sync has nothing to do.
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.Requests(http.MethodPost, "/middlewares/:id/endpoints"))
+	assert.Equal(t, 1, s.Requests(http.MethodDelete, "/endpoints/:id"))
+}
+
+func TestSyncTopicsToStarlify_Errors(t *testing.T) {
+
+	k, cluster, s := newSync(t, []string{prefix + "orders"}, []string{prefix + "stale"})
+	cluster.Fail(fake.GetTopicNames, errors.New("broker unavailable"))
+
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, KafkaError, Category(err))
+
+	// Nothing is deleted when Kafka can't be read.
+	assert.Equal(t, []string{prefix + "stale"}, s.Endpoints(middlewareId))
+}
+
+func TestSync_Mapping(t *testing.T) {
+
+	k, cluster, s := newSync(t,
+		[]string{prefix + "sales.refunds.v1"},
+		[]string{"Orders", "bad/name"},
+	)
+	k.SetMapping(&mapping.Rules{Case: mapping.CaseLower, Template: "{prefix}{domain}.{name}.v{version}",
+		Variables: map[string]string{"domain": "sales", "version": "1"}})
+
+	// Endpoint names become topic names, names that can't be mapped are skipped and block deletes.
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.ErrorIs(t, err, starlify.ErrIncomplete)
+	assert.Equal(t, []string{prefix + "sales.orders.v1", prefix + "sales.refunds.v1"}, cluster.Topics())
+
+	// Topic names become endpoint names, with the template variables as attributes.
+	cluster.AddTopic(prefix+"billing.invoices.v2", fake.Topic{})
+	cluster.AddTopic("e87654321.other", fake.Topic{})
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Orders", "bad/name", "invoices", "refunds"}, s.Endpoints(middlewareId))
+	attributes := s.Attributes(middlewareId, "invoices")
+	assert.Equal(t, "billing", attributes["domain"])
+	assert.Equal(t, "2", attributes["version"])
+}
+
+func TestSyncTopicsToKafka_Unmapped(t *testing.T) {
+
+	k, cluster, _ := newSync(t, []string{prefix + "orders", prefix + "payments"}, []string{prefix + "Orders", prefix + "orders", prefix + "Payments!"})
+	k.SetMapping(&mapping.Rules{Case: mapping.CaseLower})
+
+	// Payments! can't be mapped and Orders and orders map to the same topic: the topic of the renamed
+	// endpoint is kept, and so is every other topic.
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.ErrorIs(t, err, starlify.ErrIncomplete)
+	assert.Equal(t, ConfigError, Category(err))
+	var unmapped *UnmappedError
+	assert.ErrorAs(t, err, &unmapped)
+	assert.Equal(t, []string{prefix + "orders", prefix + "Payments!"}, unmapped.Endpoints)
+	assert.Equal(t, []string{prefix + "orders", prefix + "payments"}, cluster.Topics())
+	assert.Equal(t, 0, cluster.Calls(fake.DeleteTopics))
+}
+
+func TestSync_PrefixPolicy(t *testing.T) {
+
+	k, cluster, _ := newSync(t, []string{"payments", "other", prefix + "stale"}, []string{"orders", "refunds"})
+
+	// The prefix of the middleware must follow the policy.
+	k.SetPrefixPolicy(&pre.Policy{Pattern: "^team-"})
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, ConfigError, Category(err))
+
+	// With an allow-list, only the listed topics are managed and the prefix is not used.
+	k.SetPrefixPolicy(&pre.Policy{Topics: []string{"orders", "payments"}})
+	p, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "", p)
+	assert.Equal(t, []string{prefix + "stale", "orders", "other"}, cluster.Topics())
+}
+
+func TestSyncConsumersToStarlify(t *testing.T) {
+
+	k, cluster, s := newSync(t, []string{prefix + "orders"}, []string{prefix + "orders"})
+	cluster.AddConsumerGroup(kafka.ConsumerGroup{Group: "billing", Offsets: map[string]map[int32]int64{prefix + "orders": {0: 3}}})
+	cluster.AddConsumerGroup(kafka.ConsumerGroup{Group: "shipping", Offsets: map[string]map[int32]int64{prefix + "orders": {0: 1}}})
+
+	assert.NoError(t, k.SyncConsumersToStarlify(context.Background()))
+	assert.Equal(t, []string{"billing", "shipping"}, s.Consumers(middlewareId, prefix+"orders"))
 
-	assert.True(t, gock.IsDone())
+	cluster.AddConsumerGroup(kafka.ConsumerGroup{Group: "shipping", Offsets: map[string]map[int32]int64{"e87654321.other": {0: 1}}})
+	assert.NoError(t, k.SyncConsumersToStarlify(context.Background()))
+	assert.Equal(t, []string{"billing"}, s.Consumers(middlewareId, prefix+"orders"))
 }
-*/
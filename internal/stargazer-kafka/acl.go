@@ -0,0 +1,227 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Principal maps a Starlify system to the Kafka principal it connects as.
+type Principal struct {
+	SystemId    string
+	Principal   string
+	GroupPrefix string
+}
+
+// Validate checks that the principal names a Starlify system and a Kafka principal like User:orders.
+// An empty system would match every consumer group reported without one.
+func (p Principal) Validate() error {
+
+	if p.SystemId == "" {
+		return fmt.Errorf("principal '%s' needs a system", p.Principal)
+	}
+	kind, name, ok := strings.Cut(p.Principal, ":")
+	if !ok || kind == "" || name == "" {
+		return fmt.Errorf("invalid principal '%s' of system %s, expected a type and name like User:orders", p.Principal, p.SystemId)
+	}
+	return nil
+}
+
+// SyncACLs creates and removes Kafka ACLs so that access to the topics under the prefix follows Starlify.
+// Systems producing to an endpoint get WRITE on the topic, consuming systems get READ on the topic and
+// READ on their consumer group prefix. Only ACLs of the given principals are ever changed.
+func (k *KafkaTopicsToStarlify) SyncACLs(ctx context.Context, principals []Principal, host string) error {
+
+	if len(principals) == 0 {
+		return nil
+	}
+
+	bySystem := make(map[string]Principal)
+	var names []string
+	for _, p := range principals {
+		bySystem[p.SystemId] = p
+		names = append(names, p.Principal)
+	}
+
+	// ACLs of topics missing from an incomplete listing must not be deleted.
+	prefix, topics, err := k.getStarlifyTopics(ctx)
+	incomplete := errors.Is(err, starlify.ErrIncomplete)
+	if err != nil && !incomplete {
+		return err
+	}
+	listErr := err
+
+	desired := make(map[string]kafka.ACL)
+	add := func(acl kafka.ACL) {
+		desired[acl.Key()] = acl
+	}
+
+	for _, topic := range topics {
+		endpoint, err := k.starlify.GetEndpoint(ctx, topic.ID)
+		if err != nil {
+			return NewError(StarlifyError, fmt.Errorf("failed to get endpoint %s. %v", topic.Name, err))
+		}
+
+		for _, engagement := range endpoint.Engagements {
+			if p, ok := bySystem[engagement.System.Id]; ok {
+				add(topicACL(p, host, topic.Topic, kadm.OpWrite))
+			}
+		}
+
+		for _, interaction := range endpoint.EndpointInteractions {
+			if p, ok := bySystem[interaction.System.Id]; ok {
+				add(topicACL(p, host, topic.Topic, kadm.OpRead))
+				if p.GroupPrefix != "" {
+					add(groupACL(p, host))
+				} else {
+					log.Logger.Debugf("No group prefix for %s, skipping group ACL", p.Principal)
+				}
+			}
+		}
+	}
+
+	existing, err := k.kafka.GetACLs(ctx, names...)
+	if err != nil {
+		return NewError(KafkaError, fmt.Errorf("failed to get ACLs from Kafka. %v", err))
+	}
+
+	current := make(map[string]kafka.ACL)
+	for _, acl := range existing {
+		if k.managedACL(acl, prefix, principals, host) {
+			current[acl.Key()] = acl
+		}
+	}
+
+	var createMe, deleteMe []kafka.ACL
+	for key, acl := range desired {
+		if _, ok := current[key]; !ok {
+			createMe = append(createMe, acl)
+		}
+	}
+	for key, acl := range current {
+		if _, ok := desired[key]; !ok {
+			deleteMe = append(deleteMe, acl)
+		}
+	}
+
+	changes := &audit.Diff{}
+	for _, acl := range createMe {
+		changes.Create = append(changes.Create, acl.Key())
+	}
+	for _, acl := range deleteMe {
+		if !incomplete {
+			changes.Delete = append(changes.Delete, acl.Key())
+		}
+	}
+	sort.Strings(changes.Create)
+	sort.Strings(changes.Delete)
+
+	log.Logger.Debugf("Creating %d ACLs", len(createMe))
+	err = k.kafka.CreateACLs(ctx, createMe...)
+	if err != nil {
+		return NewError(KafkaError, err)
+	}
+	var events []audit.Event
+	for _, acl := range createMe {
+		events = append(events, audit.Event{Action: audit.ACLCreate, Target: acl.Key(), Diff: changes,
+			After: aclState(acl)})
+	}
+	k.record(ctx, prefix, events...)
+
+	if incomplete {
+		log.Ctx(ctx).Errorf("Not deleting %d ACLs, Starlify endpoints are incomplete: %v", len(deleteMe), listErr)
+		return listErr
+	}
+
+	log.Logger.Debugf("Deleting %d ACLs", len(deleteMe))
+	err = k.kafka.DeleteACLs(ctx, deleteMe...)
+	if err != nil {
+		return NewError(KafkaError, err)
+	}
+	events = nil
+	for _, acl := range deleteMe {
+		events = append(events, audit.Event{Action: audit.ACLDelete, Target: acl.Key(), Diff: changes,
+			Before: aclState(acl)})
+	}
+	k.record(ctx, prefix, events...)
+	return nil
+}
+
+// aclState returns the state of the ACL for the audit trail.
+func aclState(acl kafka.ACL) *audit.State {
+
+	state := &audit.State{Name: acl.Key(), Attributes: map[string]string{
+		"principal":  acl.Principal,
+		"host":       acl.Host,
+		"resource":   acl.Resource.String(),
+		"name":       acl.Name,
+		"pattern":    acl.Pattern.String(),
+		"operation":  acl.Operation.String(),
+		"permission": acl.Permission.String(),
+	}}
+	if acl.Resource == kmsg.ACLResourceTypeTopic {
+		state.Topic = acl.Name
+	}
+	return state
+}
+
+func topicACL(p Principal, host string, topic string, op kadm.ACLOperation) kafka.ACL {
+	return kafka.ACL{
+		Principal:  p.Principal,
+		Host:       host,
+		Resource:   kmsg.ACLResourceTypeTopic,
+		Name:       topic,
+		Pattern:    kadm.ACLPatternLiteral,
+		Operation:  op,
+		Permission: kmsg.ACLPermissionTypeAllow,
+	}
+}
+
+func groupACL(p Principal, host string) kafka.ACL {
+	return kafka.ACL{
+		Principal:  p.Principal,
+		Host:       host,
+		Resource:   kmsg.ACLResourceTypeGroup,
+		Name:       p.GroupPrefix,
+		Pattern:    kadm.ACLPatternPrefixed,
+		Operation:  kadm.OpRead,
+		Permission: kmsg.ACLPermissionTypeAllow,
+	}
+}
+
+// managedACL reports whether the ACL has the exact shape of one the agent would have created for this prefix:
+// an ALLOW of READ or WRITE on a literal managed topic, or of READ on the group prefix of the principal, for
+// the configured host. Other rules of the principals, e.g. DENY rules set by hand, are left alone.
+func (k *KafkaTopicsToStarlify) managedACL(acl kafka.ACL, prefix string, principals []Principal, host string) bool {
+
+	if acl.Permission != kmsg.ACLPermissionTypeAllow || acl.Host != host {
+		return false
+	}
+	for _, p := range principals {
+		if p.Principal != acl.Principal {
+			continue
+		}
+		switch acl.Resource {
+		case kmsg.ACLResourceTypeTopic:
+			if acl.Pattern == kadm.ACLPatternLiteral && (acl.Operation == kadm.OpRead || acl.Operation == kadm.OpWrite) &&
+				k.prefix.Manages(prefix, acl.Name) {
+				return true
+			}
+		case kmsg.ACLResourceTypeGroup:
+			if acl.Pattern == kadm.ACLPatternPrefixed && acl.Operation == kadm.OpRead && p.GroupPrefix != "" &&
+				p.GroupPrefix == acl.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
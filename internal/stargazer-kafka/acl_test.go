@@ -0,0 +1,100 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	pre "github.com/entiros/stargazer-kafka/internal/prefix"
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestPrincipal_Validate(t *testing.T) {
+	assert.NoError(t, Principal{SystemId: "system-id-123", Principal: "User:orders"}.Validate())
+	assert.Error(t, Principal{Principal: "User:orders"}.Validate())
+	assert.Error(t, Principal{SystemId: "system-id-123", Principal: "User:"}.Validate())
+	assert.Error(t, Principal{SystemId: "system-id-123", Principal: "orders"}.Validate())
+	assert.Error(t, Principal{SystemId: "system-id-123"}.Validate())
+}
+
+func TestManagedACL(t *testing.T) {
+
+	principals := []Principal{{SystemId: "system-1", Principal: "User:orders", GroupPrefix: "orders-"}}
+	p := principals[0]
+	k := &KafkaTopicsToStarlify{}
+
+	assert.True(t, k.managedACL(topicACL(p, "*", "e12345678.orders", kadm.OpRead), "e12345678.", principals, "*"))
+	assert.True(t, k.managedACL(groupACL(p, "*"), "e12345678.", principals, "*"))
+
+	assert.False(t, k.managedACL(topicACL(p, "*", "e87654321.orders", kadm.OpRead), "e12345678.", principals, "*"))
+	assert.False(t, k.managedACL(topicACL(p, "10.0.0.1", "e12345678.orders", kadm.OpRead), "e12345678.", principals, "*"))
+	deny := topicACL(p, "*", "e12345678.orders", kadm.OpRead)
+	deny.Permission = kmsg.ACLPermissionTypeDeny
+	assert.False(t, k.managedACL(deny, "e12345678.", principals, "*"))
+	assert.False(t, k.managedACL(topicACL(p, "*", "e12345678.orders", kadm.OpDescribe), "e12345678.", principals, "*"))
+	other := topicACL(Principal{Principal: "User:billing"}, "*", "e12345678.orders", kadm.OpRead)
+	assert.False(t, k.managedACL(other, "e12345678.", principals, "*"))
+	assert.False(t, k.managedACL(kafka.ACL{
+		Principal: "User:orders",
+		Resource:  kmsg.ACLResourceTypeTopic,
+		Name:      "e12345678.",
+		Pattern:   kadm.ACLPatternPrefixed,
+		Operation: kadm.OpRead,
+	}, "e12345678.", principals, "*"))
+	assert.False(t, k.managedACL(kafka.ACL{
+		Principal: "User:orders",
+		Resource:  kmsg.ACLResourceTypeGroup,
+		Name:      "billing-",
+		Pattern:   kadm.ACLPatternPrefixed,
+		Operation: kadm.OpRead,
+	}, "e12345678.", principals, "*"))
+
+	// With an allow-list, only ACLs of the listed topics are managed.
+	k.SetPrefixPolicy(&pre.Policy{Topics: []string{"orders"}})
+	assert.True(t, k.managedACL(topicACL(p, "*", "orders", kadm.OpRead), "", principals, "*"))
+	assert.False(t, k.managedACL(topicACL(p, "*", "payments", kadm.OpRead), "", principals, "*"))
+}
+
+func TestSyncACLs(t *testing.T) {
+
+	k, cluster, s := newSync(t, []string{prefix + "orders", prefix + "payments"}, nil)
+	ctx := context.Background()
+
+	orders, err := s.AddEndpoint(middlewareId, prefix+"orders")
+	assert.NoError(t, err)
+	_, err = s.AddEndpoint(middlewareId, prefix+"payments")
+	assert.NoError(t, err)
+	assert.NoError(t, s.AddProducer(orders, "system-1"))
+	assert.NoError(t, s.AddConsumer(orders, "system-2", ""))
+
+	principals := []Principal{
+		{SystemId: "system-1", Principal: "User:shop"},
+		{SystemId: "system-2", Principal: "User:billing", GroupPrefix: "billing-"},
+	}
+	billing := principals[1]
+
+	// A stale grant of the agent, and rules set by hand that are no grants of the agent.
+	stale := topicACL(billing, "*", prefix+"payments", kadm.OpRead)
+	deny := topicACL(billing, "*", prefix+"payments", kadm.OpWrite)
+	deny.Permission = kmsg.ACLPermissionTypeDeny
+	hostScoped := topicACL(billing, "10.0.0.1", prefix+"payments", kadm.OpRead)
+	describe := topicACL(billing, "*", prefix+"payments", kadm.OpDescribe)
+	assert.NoError(t, cluster.CreateACLs(ctx, stale, deny, hostScoped, describe))
+
+	assert.NoError(t, k.SyncACLs(ctx, principals, "*"))
+
+	var keys []string
+	for _, acl := range cluster.ACLs() {
+		keys = append(keys, acl.Key())
+	}
+	assert.ElementsMatch(t, []string{
+		topicACL(principals[0], "*", prefix+"orders", kadm.OpWrite).Key(),
+		topicACL(billing, "*", prefix+"orders", kadm.OpRead).Key(),
+		groupACL(billing, "*").Key(),
+		deny.Key(),
+		hostScoped.Key(),
+		describe.Key(),
+	}, keys)
+}
@@ -0,0 +1,174 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// Endpoint attributes describing the topic.
+const (
+	AttributePartitions        = "partitions"
+	AttributeReplicationFactor = "replication.factor"
+	AttributeRetention         = "retention.ms"
+	AttributeCleanupPolicy     = "cleanup.policy"
+	AttributeMinISR            = "min.insync.replicas"
+	// AttributeFirstSeen is when the agent first saw the topic. It is not when Kafka created the topic, which
+	// Kafka does not tell.
+	AttributeFirstSeen = "first.seen"
+)
+
+// topicConfigAttributes are the topic configs reported as attributes.
+var topicConfigAttributes = []string{AttributeRetention, AttributeCleanupPolicy, AttributeMinISR}
+
+// getTopicAttributes returns the attributes of each of the topics, by topic name.
+func (k *KafkaTopicsToStarlify) getTopicAttributes(ctx context.Context, topics []string) (map[string][]starlify.Attribute, error) {
+
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	details, err := k.kafka.GetTopics(ctx)
+	if err != nil {
+		return nil, NewError(KafkaError, fmt.Errorf("failed to get topic details from Kafka with error: %v", err))
+	}
+
+	configs, err := k.kafka.GetTopicConfigs(ctx, topics...)
+	if err != nil {
+		return nil, NewError(KafkaError, fmt.Errorf("failed to get topic configs from Kafka with error: %v", err))
+	}
+
+	attributes := make(map[string][]starlify.Attribute)
+	for _, topic := range topics {
+		detail, ok := details[topic]
+		if !ok {
+			continue
+		}
+		attributes[topic] = topicAttributes(detail, configs[topic])
+	}
+	return attributes, nil
+}
+
+// topicAttributes returns the attributes of the topic, sorted by name.
+func topicAttributes(detail kadm.TopicDetail, configs map[string]string) []starlify.Attribute {
+
+	var replicationFactor int
+	for _, partition := range detail.Partitions {
+		if len(partition.Replicas) > replicationFactor {
+			replicationFactor = len(partition.Replicas)
+		}
+	}
+
+	attributes := []starlify.Attribute{
+		{Name: AttributePartitions, Value: strconv.Itoa(len(detail.Partitions))},
+		{Name: AttributeReplicationFactor, Value: strconv.Itoa(replicationFactor)},
+	}
+	for _, name := range topicConfigAttributes {
+		if value, ok := configs[name]; ok {
+			attributes = append(attributes, starlify.Attribute{Name: name, Value: value})
+		}
+	}
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Name < attributes[j].Name
+	})
+	return attributes
+}
+
+// mergeAttributes returns current with the topic, schema and payload attributes replaced by topicAttributes. Other attributes,
+// like template variables, are kept, and so is first.seen. First.seen is set to now if current has none.
+func mergeAttributes(current []starlify.Attribute, topicAttributes []starlify.Attribute, now time.Time) []starlify.Attribute {
+
+	managed := map[string]bool{AttributePartitions: true, AttributeReplicationFactor: true}
+	for _, name := range topicConfigAttributes {
+		managed[name] = true
+	}
+
+	seen := false
+	var result []starlify.Attribute
+	for _, attribute := range current {
+		if !managed[attribute.Name] && !strings.HasPrefix(attribute.Name, AttributeSchemaPrefix) &&
+			!strings.HasPrefix(attribute.Name, AttributePayloadPrefix) {
+			result = append(result, attribute)
+		}
+		if attribute.Name == AttributeFirstSeen {
+			seen = true
+		}
+	}
+	if !seen {
+		result = append(result, starlify.Attribute{Name: AttributeFirstSeen, Value: now.UTC().Format(time.RFC3339)})
+	}
+	result = append(result, topicAttributes...)
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// variableAttributes returns template variables as attributes, sorted by name.
+func variableAttributes(variables map[string]string) []starlify.Attribute {
+
+	var attributes []starlify.Attribute
+	for name, value := range variables {
+		attributes = append(attributes, starlify.Attribute{Name: name, Value: value})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Name < attributes[j].Name
+	})
+	return attributes
+}
+
+// sameAttributes reports whether a and b have the same attributes, in any order.
+func sameAttributes(a []starlify.Attribute, b []starlify.Attribute) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	values := make(map[string]string)
+	for _, attribute := range a {
+		values[attribute.Name] = attribute.Value
+	}
+	for _, attribute := range b {
+		if value, ok := values[attribute.Name]; !ok || value != attribute.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// updateAttributes updates the attributes of the endpoints whose topic changed.
+func (k *KafkaTopicsToStarlify) updateAttributes(ctx context.Context, prefix string, endpoints []starlify.TopicEndpoint, attributes map[string][]starlify.Attribute) error {
+
+	for _, endpoint := range endpoints {
+		topicAttributes, ok := attributes[endpoint.Topic]
+		if !ok {
+			continue
+		}
+		desired := mergeAttributes(endpoint.Attributes, topicAttributes, time.Now())
+		if sameAttributes(desired, endpoint.Attributes) {
+			continue
+		}
+
+		log.Ctx(ctx).Debugf("Attributes of %s changed: %v", endpoint.Name, desired)
+		err := k.starlify.UpdateAttributes(ctx, endpoint, desired)
+		if err != nil {
+			return NewError(StarlifyError, err)
+		}
+		metrics.EndpointsUpdated.WithLabelValues(k.name, prefix).Inc()
+		k.record(ctx, prefix, audit.Event{Action: audit.EndpointUpdate, Target: endpoint.Name,
+			Before: endpointState(endpoint.ID, endpoint.Name, endpoint.Topic, endpoint.Attributes),
+			After:  endpointState(endpoint.ID, endpoint.Name, endpoint.Topic, desired),
+			Diff:   &audit.Diff{Changed: changedAttributes(endpoint.Attributes, desired)}})
+	}
+	return nil
+}
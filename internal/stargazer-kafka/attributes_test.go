@@ -0,0 +1,68 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTopicsToStarlify_Attributes(t *testing.T) {
+
+	k, cluster, s := newSync(t, nil, []string{prefix + "orders"})
+	k.SetAttributes(true)
+	cluster.AddTopic(prefix+"orders", fake.Topic{Partitions: 3, ReplicationFactor: 2})
+	cluster.AddTopic(prefix+"payments", fake.Topic{
+		Partitions:        6,
+		ReplicationFactor: 3,
+		Configs: map[string]string{
+			"retention.ms":        "604800000",
+			"cleanup.policy":      "compact",
+			"min.insync.replicas": "2",
+			"segment.bytes":       "1073741824",
+		},
+	})
+
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+
+	payments := s.Attributes(middlewareId, prefix+"payments")
+	assert.Equal(t, "6", payments[AttributePartitions])
+	assert.Equal(t, "3", payments[AttributeReplicationFactor])
+	assert.Equal(t, "604800000", payments[AttributeRetention])
+	assert.Equal(t, "compact", payments[AttributeCleanupPolicy])
+	assert.Equal(t, "2", payments[AttributeMinISR])
+	assert.NotEmpty(t, payments[AttributeFirstSeen])
+	assert.NotContains(t, payments, "segment.bytes")
+
+	// Existing endpoints get attributes too.
+	orders := s.Attributes(middlewareId, prefix+"orders")
+	assert.Equal(t, "3", orders[AttributePartitions])
+	assert.Equal(t, 1, s.Requests(http.MethodPatch, "/endpoints/:id"))
+
+	// Unchanged topics are not updated again.
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Requests(http.MethodPatch, "/endpoints/:id"))
+
+	// Changed topics are, keeping when they were first seen.
+	cluster.AddTopic(prefix+"orders", fake.Topic{Partitions: 12, ReplicationFactor: 2})
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.Requests(http.MethodPatch, "/endpoints/:id"))
+	assert.Equal(t, "12", s.Attributes(middlewareId, prefix+"orders")[AttributePartitions])
+	assert.Equal(t, orders[AttributeFirstSeen], s.Attributes(middlewareId, prefix+"orders")[AttributeFirstSeen])
+}
+
+func TestSyncTopicsToStarlify_AttributesDisabled(t *testing.T) {
+
+	k, cluster, s := newSync(t, []string{prefix + "orders"}, nil)
+	k.SetAttributes(false)
+
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, s.Attributes(middlewareId, prefix+"orders"))
+	assert.Equal(t, 0, cluster.Calls(fake.GetTopicConfigs))
+}
@@ -0,0 +1,52 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"sort"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// SetAudit records the changes of the syncs in trail, or nowhere with a nil trail.
+func (k *KafkaTopicsToStarlify) SetAudit(trail *audit.Trail) {
+	k.audit = trail
+}
+
+// record writes the events to the audit trail. The changes are made already, so failures are only logged and counted.
+func (k *KafkaTopicsToStarlify) record(ctx context.Context, prefix string, events ...audit.Event) {
+
+	if err := k.audit.Record(ctx, prefix, events...); err != nil {
+		metrics.Errors.WithLabelValues(k.name, AuditError).Inc()
+	}
+}
+
+// endpointState returns the state of an endpoint with the attributes.
+func endpointState(id string, name string, topic string, attributes []starlify.Attribute) *audit.State {
+
+	state := &audit.State{Name: name, Id: id, Topic: topic}
+	if len(attributes) > 0 {
+		state.Attributes = attributeValues(attributes)
+	}
+	return state
+}
+
+// changedAttributes returns the sorted names of the attributes that differ between before and after.
+func changedAttributes(before []starlify.Attribute, after []starlify.Attribute) []string {
+
+	a, b := attributeValues(before), attributeValues(after)
+	var changed []string
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			changed = append(changed, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,119 @@
+package stargazer_kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAudit(t *testing.T, path string) []audit.Event {
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var events []audit.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event audit.Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestSyncTopicsToKafka_Audit(t *testing.T) {
+
+	k, _, _ := newSync(t, []string{prefix + "stale"}, []string{prefix + "orders"})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	k.SetAudit(&audit.Trail{System: "orders.yaml", Direction: "starlify_to_kafka", Sinks: []audit.Sink{&audit.FileSink{Path: path}}})
+
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+
+	events := readAudit(t, path)
+	assert.Len(t, events, 2)
+	assert.Equal(t, audit.TopicCreate, events[0].Action)
+	assert.Equal(t, prefix+"orders", events[0].Target)
+	assert.Equal(t, prefix+"orders", events[0].After.Endpoint)
+	assert.Equal(t, audit.TopicDelete, events[1].Action)
+	assert.Equal(t, prefix+"stale", events[1].Target)
+	assert.Equal(t, prefix, events[1].Prefix)
+	assert.Equal(t, &audit.Diff{Create: []string{prefix + "orders"}, Delete: []string{prefix + "stale"}}, events[1].Diff)
+
+	// Nothing is recorded when nothing changes.
+	_, err = k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, readAudit(t, path), 2)
+}
+
+func TestSyncTopicsToKafka_AuditRefused(t *testing.T) {
+
+	k, cluster, _ := newSync(t, []string{prefix + "stale", prefix + "old"}, []string{prefix + "orders", prefix + "payments"})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	k.SetAudit(&audit.Trail{System: "orders.yaml", Direction: "starlify_to_kafka", Sinks: []audit.Sink{&audit.FileSink{Path: path}}})
+
+	// Only the topics the cluster created are recorded, and nothing is deleted.
+	cluster.Refuse(fake.CreateTopics, errors.New("policy violation"), prefix+"payments")
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, KafkaError, Category(err))
+	events := readAudit(t, path)
+	assert.Len(t, events, 1)
+	assert.Equal(t, audit.TopicCreate, events[0].Action)
+	assert.Equal(t, prefix+"orders", events[0].Target)
+	assert.Equal(t, []string{prefix + "old", prefix + "orders", prefix + "stale"}, cluster.Topics())
+
+	// Only the topics the cluster deleted are recorded.
+	cluster.Refuse(fake.CreateTopics, nil, prefix+"payments")
+	cluster.Refuse(fake.DeleteTopics, errors.New("cluster authorization failed"), prefix+"old")
+	_, err = k.SyncTopicsToKafka(context.Background())
+	assert.Error(t, err)
+	events = readAudit(t, path)
+	assert.Len(t, events, 3)
+	assert.Equal(t, audit.TopicCreate, events[1].Action)
+	assert.Equal(t, prefix+"payments", events[1].Target)
+	assert.Equal(t, audit.TopicDelete, events[2].Action)
+	assert.Equal(t, prefix+"stale", events[2].Target)
+	assert.Equal(t, []string{prefix + "old", prefix + "orders", prefix + "payments"}, cluster.Topics())
+}
+
+func TestSyncTopicsToStarlify_Audit(t *testing.T) {
+
+	k, cluster, _ := newSync(t, []string{prefix + "orders"}, []string{prefix + "stale"})
+	k.SetAttributes(true)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	k.SetAudit(&audit.Trail{System: "orders.yaml", Direction: "kafka_to_starlify", Sinks: []audit.Sink{&audit.FileSink{Path: path}}})
+
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+
+	events := readAudit(t, path)
+	assert.Len(t, events, 2)
+	assert.Equal(t, audit.EndpointCreate, events[0].Action)
+	assert.Equal(t, prefix+"orders", events[0].Target)
+	assert.Equal(t, "1", events[0].After.Attributes[AttributePartitions])
+	assert.Equal(t, audit.EndpointDelete, events[1].Action)
+	assert.Equal(t, prefix+"stale", events[1].Target)
+	assert.NotEmpty(t, events[1].Before.Id)
+
+	// Changed configs update the endpoint.
+	cluster.AddTopic(prefix+"orders", fake.Topic{Partitions: 3})
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+
+	events = readAudit(t, path)
+	assert.Len(t, events, 3)
+	assert.Equal(t, audit.EndpointUpdate, events[2].Action)
+	assert.Equal(t, "1", events[2].Before.Attributes[AttributePartitions])
+	assert.Equal(t, "3", events[2].After.Attributes[AttributePartitions])
+	assert.Equal(t, []string{AttributePartitions}, events[2].Diff.Changed)
+}
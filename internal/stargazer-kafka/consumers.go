@@ -0,0 +1,77 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// SyncConsumersToStarlify reports the consumer groups reading topics under the prefix as consumers of
+// the matching Starlify endpoints. Consumers reported earlier whose group no longer reads the topic are removed.
+func (k *KafkaTopicsToStarlify) SyncConsumersToStarlify(ctx context.Context) error {
+
+	prefix, topics, err := k.getStarlifyTopics(ctx)
+	var unmapped *UnmappedError
+	if err != nil && !errors.As(err, &unmapped) {
+		return err
+	}
+
+	groups, err := k.kafka.GetConsumerGroups(ctx, prefix)
+	if err != nil {
+		return NewError(KafkaError, fmt.Errorf("failed to get consumer groups from Kafka with error: %v", err))
+	}
+
+	consumers := make(map[string][]string)
+	for _, group := range groups {
+		for _, topic := range group.Topics() {
+			consumers[topic] = append(consumers[topic], group.Group)
+		}
+	}
+	log.Logger.Debugf("%d consumer groups found for prefix %s", len(groups), prefix)
+
+	for _, topic := range topics {
+		endpoint, err := k.starlify.GetEndpoint(ctx, topic.ID)
+		if err != nil {
+			return NewError(StarlifyError, fmt.Errorf("failed to get endpoint %s. %v", topic.Name, err))
+		}
+
+		var reported []string
+		for _, interaction := range endpoint.EndpointInteractions {
+			if interaction.ConsumerGroup != "" {
+				reported = append(reported, interaction.ConsumerGroup)
+			}
+		}
+
+		createMe, deleteMe := ListDiff(reported, consumers[topic.Topic])
+
+		for _, group := range createMe {
+			err = k.starlify.CreateConsumer(ctx, topic, group)
+			if err != nil {
+				return NewError(StarlifyError, err)
+			}
+		}
+
+		for _, interaction := range endpoint.EndpointInteractions {
+			if interaction.ConsumerGroup != "" && contains(deleteMe, interaction.ConsumerGroup) {
+				err = k.starlify.DeleteConsumer(ctx, interaction)
+				if err != nil && !errors.Is(err, starlify.ErrNotFound) {
+					return NewError(StarlifyError, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package stargazer_kafka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// Error categories, used to label error metrics.
+const (
+	KafkaError          = "kafka"
+	StarlifyError       = "starlify"
+	ConfigError         = "config"
+	SchemaRegistryError = "schema_registry"
+	AuditError          = "audit"
+	UnknownError        = "unknown"
+)
+
+// Error is an error tagged with the part of the agent it originates from.
+type Error struct {
+	Category string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError tags err with category. A nil err stays nil.
+func NewError(category string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Category: category, Err: err}
+}
+
+// UnmappedError is returned with the endpoints that could not be mapped to a topic of their own. It makes the
+// listing of endpoints incomplete: the topics of the endpoints are unknown, so no topic may be deleted.
+type UnmappedError struct {
+	Endpoints []string
+}
+
+func (e *UnmappedError) Error() string {
+	return fmt.Sprintf("incomplete listing, endpoints could not be mapped to topics: %s", strings.Join(e.Endpoints, ", "))
+}
+
+func (e *UnmappedError) Is(target error) bool {
+	return target == starlify.ErrIncomplete
+}
+
+// Category returns the category of err, or UnknownError if it has none.
+func Category(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+	return UnknownError
+}
+
+// codes are the stable codes of the error categories, reported to Starlify with the errors.
+var codes = map[string]string{
+	KafkaError:          "KAFKA_ERROR",
+	StarlifyError:       "STARLIFY_ERROR",
+	ConfigError:         "CONFIG_ERROR",
+	SchemaRegistryError: "SCHEMA_REGISTRY_ERROR",
+	AuditError:          "AUDIT_ERROR",
+	UnknownError:        "UNKNOWN_ERROR",
+}
+
+// Code returns the stable code of the category of err, e.g. KAFKA_ERROR.
+func Code(err error) string {
+	if code, ok := codes[Category(err)]; ok {
+		return code
+	}
+	return codes[UnknownError]
+}
@@ -0,0 +1,23 @@
+package stargazer_kafka
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategory(t *testing.T) {
+	assert.Nil(t, NewError(KafkaError, nil))
+	assert.Equal(t, KafkaError, Category(NewError(KafkaError, errors.New("broker down"))))
+	assert.Equal(t, StarlifyError, Category(fmt.Errorf("sync: %w", NewError(StarlifyError, errors.New("401")))))
+	assert.Equal(t, UnknownError, Category(errors.New("other")))
+}
+
+func TestCode(t *testing.T) {
+	assert.Equal(t, "KAFKA_ERROR", Code(NewError(KafkaError, errors.New("broker down"))))
+	assert.Equal(t, "SCHEMA_REGISTRY_ERROR", Code(fmt.Errorf("sync: %w", NewError(SchemaRegistryError, errors.New("409")))))
+	assert.Equal(t, "UNKNOWN_ERROR", Code(NewError("other", errors.New("other"))))
+	assert.Equal(t, "UNKNOWN_ERROR", Code(errors.New("other")))
+}
@@ -0,0 +1,48 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+)
+
+// ReportLag exports consumer group lag and, if throughput is set, produced message rate for the topics under the prefix.
+func (k *KafkaTopicsToStarlify) ReportLag(ctx context.Context, system string, prefix string, lag bool, throughput bool) error {
+
+	if !lag && !throughput {
+		return nil
+	}
+
+	topics, err := k.getKafkaTopics(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	end, err := k.kafka.GetEndOffsets(ctx, topics...)
+	if err != nil {
+		return NewError(KafkaError, fmt.Errorf("failed to get end offsets from Kafka with error: %v", err))
+	}
+
+	if throughput {
+		metrics.SetEndOffsets(system, end, time.Now())
+	}
+
+	if !lag {
+		return nil
+	}
+
+	groups, err := k.kafka.GetConsumerGroups(ctx, prefix)
+	if err != nil {
+		return NewError(KafkaError, fmt.Errorf("failed to get consumer groups from Kafka with error: %v", err))
+	}
+
+	committed := make(map[string]map[string]map[int32]int64)
+	for _, group := range groups {
+		committed[group.Group] = group.Offsets
+	}
+	metrics.SetConsumerLag(system, committed, end)
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package stargazer_kafka
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/entiros/stargazer-kafka/internal/webhook"
+)
+
+// changes describes the events of the changes of a sync, for messages like "created 2 topics in Kafka".
+var changes = map[string]string{
+	webhook.TopicsCreated:    "created %d topics in Kafka",
+	webhook.TopicsDeleted:    "deleted %d topics from Kafka",
+	webhook.EndpointsCreated: "created %d endpoints in Starlify",
+	webhook.EndpointsDeleted: "deleted %d endpoints from Starlify",
+}
+
+// SetNotifier notifies webhooks of the changes of the syncs, or none with a nil notifier.
+func (k *KafkaTopicsToStarlify) SetNotifier(notifier *webhook.Notifier) {
+	k.notifier = notifier
+}
+
+// notify notifies the webhooks of a change of the names, if there are any.
+func (k *KafkaTopicsToStarlify) notify(event string, prefix string, names []string) {
+
+	if len(names) == 0 {
+		return
+	}
+	message := fmt.Sprintf("System %s "+changes[event], k.name, len(names))
+	if prefix != "" {
+		message += " under " + prefix
+	}
+	k.notifier.Notify(event, prefix, message+": "+strings.Join(names, ", "), names...)
+}
+
+// notifyBlocked notifies the webhooks of deletes of the names skipped for reason.
+func (k *KafkaTopicsToStarlify) notifyBlocked(prefix string, names []string, reason error) {
+
+	if len(names) == 0 {
+		return
+	}
+	message := fmt.Sprintf("System %s did not delete %d topics or endpoints: %v. Skipped: %s", k.name, len(names), reason, strings.Join(names, ", "))
+	k.notifier.Notify(webhook.DeletionBlocked, prefix, message, names...)
+}
@@ -0,0 +1,51 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTopicsToKafka_Notify(t *testing.T) {
+
+	var mu sync.Mutex
+	var notifications []webhook.Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification webhook.Notification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		mu.Lock()
+		notifications = append(notifications, notification)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go webhook.Run(ctx, 1)
+
+	k, _, _ := newSync(t, []string{prefix + "stale"}, []string{prefix + "orders", prefix + "payments"})
+	k.SetNotifier(&webhook.Notifier{System: "orders.yaml", Hooks: []webhook.Hook{{URL: srv.URL}}})
+
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(notifications) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, webhook.TopicsCreated, notifications[0].Event)
+	assert.Equal(t, prefix, notifications[0].Prefix)
+	assert.Equal(t, []string{prefix + "orders", prefix + "payments"}, notifications[0].Names)
+	assert.Equal(t, "System "+t.Name()+" created 2 topics in Kafka under "+prefix+": "+prefix+"orders, "+prefix+"payments", notifications[0].Message)
+	assert.Equal(t, webhook.TopicsDeleted, notifications[1].Event)
+	assert.Equal(t, []string{prefix + "stale"}, notifications[1].Names)
+}
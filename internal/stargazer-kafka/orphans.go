@@ -0,0 +1,208 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	pre "github.com/entiros/stargazer-kafka/internal/prefix"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/entiros/stargazer-kafka/internal/webhook"
+)
+
+// Kinds of orphaned topics, topics outside any prefix.
+const (
+	OrphanUnprefixed = "unprefixed"
+	OrphanInternal   = "internal"
+)
+
+// What to do with orphaned topics.
+const (
+	// OrphanIgnore leaves the topics alone.
+	OrphanIgnore = "ignore"
+	// OrphanReport exports the topics as metrics and in the admin API.
+	OrphanReport = "report"
+	// OrphanMiddleware reports the topics and syncs them as endpoints of the unassigned middleware.
+	OrphanMiddleware = "middleware"
+)
+
+// DefaultInternalTopics match the topics of Kafka itself, Schema Registry and Kafka Connect.
+var DefaultInternalTopics = []string{`^__`, `^_schemas$`, `^_confluent`, `^connect-(configs|offsets|status)$`}
+
+// OrphanPolicy is what to do with the topics of a cluster that have no prefix.
+type OrphanPolicy struct {
+	// Unprefixed and Internal are the actions for each kind, OrphanIgnore if empty.
+	Unprefixed string
+	Internal   string
+	// InternalTopics are regular expressions of internal topic names, DefaultInternalTopics if empty.
+	InternalTopics []string
+	// MiddlewareId is the Starlify middleware of orphaned topics with action OrphanMiddleware.
+	MiddlewareId string
+}
+
+// Validate checks the actions and patterns of the policy.
+func (p *OrphanPolicy) Validate() error {
+
+	middleware := false
+	for _, action := range []string{p.Unprefixed, p.Internal} {
+		switch action {
+		case "", OrphanIgnore, OrphanReport:
+		case OrphanMiddleware:
+			middleware = true
+		default:
+			return fmt.Errorf("invalid orphan action '%s', valid values are %s, %s or %s", action, OrphanIgnore, OrphanReport, OrphanMiddleware)
+		}
+	}
+	if middleware && p.MiddlewareId == "" {
+		return fmt.Errorf("orphan action %s needs a middlewareId", OrphanMiddleware)
+	}
+	if !middleware && p.MiddlewareId != "" {
+		return fmt.Errorf("orphan middlewareId needs the action %s", OrphanMiddleware)
+	}
+	for _, pattern := range p.InternalTopics {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid internal topic pattern '%s'. %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Action returns the action for orphaned topics of kind.
+func (p *OrphanPolicy) Action(kind string) string {
+
+	action := p.Unprefixed
+	if kind == OrphanInternal {
+		action = p.Internal
+	}
+	if action == "" {
+		return OrphanIgnore
+	}
+	return action
+}
+
+// Classify returns the topics that none of the prefix policies finds a prefix in or lists, by kind.
+// Topics of kinds that are ignored are left out.
+func (p *OrphanPolicy) Classify(topics []string, policies []*pre.Policy) map[string][]string {
+
+	patterns := p.InternalTopics
+	if len(patterns) == 0 {
+		patterns = DefaultInternalTopics
+	}
+	var internal []*regexp.Regexp
+	for _, pattern := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil {
+			internal = append(internal, re)
+		}
+	}
+
+	orphans := make(map[string][]string)
+topics:
+	for _, topic := range topics {
+		for _, policy := range policies {
+			if _, ok := policy.Extract(topic); ok {
+				continue topics
+			}
+			if policy != nil && len(policy.Topics) > 0 && policy.Manages("", topic) {
+				continue topics
+			}
+		}
+
+		kind := OrphanUnprefixed
+		for _, re := range internal {
+			if re.MatchString(topic) {
+				kind = OrphanInternal
+				break
+			}
+		}
+		if p.Action(kind) != OrphanIgnore {
+			orphans[kind] = append(orphans[kind], topic)
+		}
+	}
+	return orphans
+}
+
+// PrefixPolicy returns the prefix policy of the Kafka prefix, nil for prefix.Default.
+func (k *KafkaTopicsToStarlify) PrefixPolicy() *pre.Policy {
+	return k.prefix
+}
+
+// GetAllTopics returns the sorted names of all topics in the cluster.
+func (k *KafkaTopicsToStarlify) GetAllTopics(ctx context.Context) ([]string, error) {
+
+	topics, err := k.kafka.GetTopicNames(ctx, "")
+	if err != nil {
+		return nil, NewError(KafkaError, fmt.Errorf("failed to get topics from Kafka with error: %v", err))
+	}
+	return topics, nil
+}
+
+// SyncOrphansToStarlify makes the topics the endpoints of the middleware, which holds nothing but orphaned topics.
+// Endpoint names are topic names.
+func (k *KafkaTopicsToStarlify) SyncOrphansToStarlify(ctx context.Context, middlewareId string, topics []string) error {
+
+	unassigned := *k.starlify
+	unassigned.MiddlewareId = middlewareId
+
+	endpoints, err := unassigned.GetEndpoints(ctx)
+	incomplete := errors.Is(err, starlify.ErrIncomplete)
+	if err != nil && !incomplete {
+		return NewError(StarlifyError, err)
+	}
+
+	var names []string
+	ids := make(map[string]string)
+	for _, endpoint := range endpoints {
+		names = append(names, endpoint.Name)
+		ids[endpoint.Name] = endpoint.Id
+	}
+
+	createMe, deleteMe := diff(ctx, names, topics)
+	changes := &audit.Diff{Create: createMe, Delete: deleteMe}
+
+	log.Ctx(ctx).Debugf("Creating orphaned topics in %s: %v", middlewareId, createMe)
+	var created []string
+	defer func() { k.notify(webhook.EndpointsCreated, "", created) }()
+	for _, topic := range createMe {
+		err := unassigned.CreateTopic(ctx, topic)
+		if errors.Is(err, starlify.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return NewError(StarlifyError, err)
+		}
+		metrics.TopicsCreated.WithLabelValues(k.name, "").Inc()
+		k.record(ctx, "", audit.Event{Action: audit.EndpointCreate, Target: topic, Diff: changes,
+			After: &audit.State{Name: topic, Topic: topic}})
+		created = append(created, topic)
+	}
+
+	// Endpoints missing from an incomplete listing would be created again, but none must be deleted.
+	if incomplete {
+		log.Ctx(ctx).Errorf("Not deleting orphaned topics %v, Starlify endpoints are incomplete: %v", deleteMe, err)
+		k.notifyBlocked("", deleteMe, err)
+		return NewError(StarlifyError, err)
+	}
+
+	log.Ctx(ctx).Debugf("Deleting orphaned topics from %s: %v", middlewareId, deleteMe)
+	var deleted []string
+	defer func() { k.notify(webhook.EndpointsDeleted, "", deleted) }()
+	for _, topic := range deleteMe {
+		err := unassigned.DeleteTopic(ctx, starlify.TopicEndpoint{Name: topic, ID: ids[topic]})
+		if errors.Is(err, starlify.ErrNotFound) {
+			log.Ctx(ctx).Debugf("Orphaned endpoint %s already deleted", topic)
+			continue
+		}
+		if err != nil {
+			return NewError(StarlifyError, err)
+		}
+		metrics.TopicsDeleted.WithLabelValues(k.name, "").Inc()
+		k.record(ctx, "", audit.Event{Action: audit.EndpointDelete, Target: topic, Diff: changes,
+			Before: &audit.State{Name: topic, Id: ids[topic], Topic: topic}})
+		deleted = append(deleted, topic)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	pre "github.com/entiros/stargazer-kafka/internal/prefix"
+	starlifyfake "github.com/entiros/stargazer-kafka/internal/starlify/fake"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanPolicy_Validate(t *testing.T) {
+	assert.NoError(t, (&OrphanPolicy{}).Validate())
+	assert.NoError(t, (&OrphanPolicy{Unprefixed: OrphanMiddleware, MiddlewareId: "unassigned"}).Validate())
+	assert.Error(t, (&OrphanPolicy{Internal: "delete"}).Validate())
+	assert.Error(t, (&OrphanPolicy{Unprefixed: OrphanMiddleware}).Validate())
+	assert.Error(t, (&OrphanPolicy{Unprefixed: OrphanReport, MiddlewareId: "unassigned"}).Validate())
+	assert.Error(t, (&OrphanPolicy{InternalTopics: []string{"("}}).Validate())
+}
+
+func TestOrphanPolicy_Classify(t *testing.T) {
+
+	topics := []string{"", "a", prefix + "orders", "e87654321.orders", "orders", "listed", "__consumer_offsets", "_schemas", "connect-offsets"}
+	policies := []*pre.Policy{nil, {Topics: []string{"listed"}}}
+
+	p := &OrphanPolicy{Unprefixed: OrphanReport, Internal: OrphanReport}
+	assert.Equal(t, map[string][]string{
+		OrphanUnprefixed: {"", "a", "orders"},
+		OrphanInternal:   {"__consumer_offsets", "_schemas", "connect-offsets"},
+	}, p.Classify(topics, policies))
+
+	p = &OrphanPolicy{Unprefixed: OrphanReport, InternalTopics: []string{"^_"}}
+	assert.Equal(t, map[string][]string{
+		OrphanUnprefixed: {"", "a", "orders", "connect-offsets"},
+	}, p.Classify(topics, policies))
+
+	assert.Empty(t, (&OrphanPolicy{}).Classify(topics, policies))
+}
+
+func TestSyncOrphansToStarlify(t *testing.T) {
+
+	k, _, s := newSync(t, nil, nil)
+	s.AddMiddleware("unassigned-id", "Unassigned", "")
+	_, err := s.AddEndpoint("unassigned-id", "deleted")
+	assert.NoError(t, err)
+
+	err = k.SyncOrphansToStarlify(context.Background(), "unassigned-id", []string{"orders", "payments"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders", "payments"}, s.Endpoints("unassigned-id"))
+	assert.Empty(t, s.Endpoints(middlewareId))
+}
+
+func TestSyncOrphansToStarlify_AlreadyDeleted(t *testing.T) {
+
+	k, _, s := newSync(t, nil, nil)
+	s.AddMiddleware("unassigned-id", "Unassigned", "")
+	_, err := s.AddEndpoint("unassigned-id", "deleted")
+	assert.NoError(t, err)
+
+	// The endpoint is deleted by someone else between the listing and the delete.
+	handler := s.Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			handler.ServeHTTP(httptest.NewRecorder(), r.Clone(r.Context()))
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	k.starlify.BaseUrl = srv.URL + starlifyfake.BasePath
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	k.SetAudit(&audit.Trail{System: "orders.yaml", Direction: "kafka_to_starlify", Sinks: []audit.Sink{&audit.FileSink{Path: path}}})
+	deleted := metrics.TopicsDeleted.WithLabelValues(k.name, "")
+
+	err = k.SyncOrphansToStarlify(context.Background(), "unassigned-id", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, s.Endpoints("unassigned-id"))
+	assert.Equal(t, 0.0, testutil.ToFloat64(deleted))
+	assert.NoFileExists(t, path)
+}
@@ -0,0 +1,24 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// GetPrefixes returns the prefixes of all topics in the cluster, as extracted by the prefix policy.
+func (k *KafkaTopicsToStarlify) GetPrefixes(ctx context.Context) ([]string, error) {
+
+	prefixes, err := kafka.Prefixes(ctx, k.kafka, k.prefix)
+	if err != nil {
+		return nil, NewError(KafkaError, fmt.Errorf("failed to get prefixes from Kafka with error: %v", err))
+	}
+	return prefixes, nil
+}
+
+// ReportUnmanagedPrefixes reports the prefixes of the cluster that no system manages in the agent details.
+func (k *KafkaTopicsToStarlify) ReportUnmanagedPrefixes(ctx context.Context, prefixes []string) error {
+	return NewError(StarlifyError, k.starlify.UpdateDetails(ctx, starlify.Details{UnmanagedPrefixes: prefixes}))
+}
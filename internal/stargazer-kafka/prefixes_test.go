@@ -0,0 +1,20 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportUnmanagedPrefixes(t *testing.T) {
+
+	k, _, s := newSync(t, []string{prefix + "orders", "e87654321.orders", "orders"}, nil)
+
+	prefixes, err := k.GetPrefixes(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix, "e87654321."}, prefixes)
+
+	assert.NoError(t, k.ReportUnmanagedPrefixes(context.Background(), []string{"e87654321."}))
+	assert.Equal(t, []string{"e87654321."}, s.AgentDetails(agentId).UnmanagedPrefixes)
+}
@@ -0,0 +1,69 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// reported is the error last shown on each agent, by Starlify and agent id, since systems are created again
+// every cycle. Agents without one may still show an error reported before a restart.
+var (
+	reportedMu sync.Mutex
+	reported   = make(map[string]string)
+)
+
+// ErrorMessage returns the message of err reported to Starlify, e.g. "[KAFKA_ERROR] broker down".
+func ErrorMessage(err error) string {
+	return fmt.Sprintf("[%s] %v", Code(err), err)
+}
+
+// ReportError shows err on the agent of client, unless the agent already shows the same error.
+func ReportError(ctx context.Context, client *starlify.Client, err error) error {
+	return showError(ctx, client, ErrorMessage(err))
+}
+
+// ClearError clears the error shown on the agent of client, unless it is known to show none.
+func ClearError(ctx context.Context, client *starlify.Client) error {
+	return showError(ctx, client, "")
+}
+
+// showError shows message on the agent of client, none if empty, unless it was the last one shown.
+func showError(ctx context.Context, client *starlify.Client, message string) error {
+
+	key := client.BaseUrl + "/agents/" + client.AgentId
+
+	reportedMu.Lock()
+	last, ok := reported[key]
+	reportedMu.Unlock()
+	if ok && last == message {
+		return nil
+	}
+
+	if err := client.ReportError(ctx, message); err != nil {
+		return err
+	}
+	if message == "" {
+		log.Ctx(ctx).Infof("Cleared error of agent %s", client.AgentId)
+	} else {
+		log.Ctx(ctx).Infof("Reported error to agent %s: %s", client.AgentId, message)
+	}
+
+	reportedMu.Lock()
+	reported[key] = message
+	reportedMu.Unlock()
+	return nil
+}
+
+// ReportError shows err on the agent of the system, unless the agent already shows the same error.
+func (k *KafkaTopicsToStarlify) ReportError(ctx context.Context, err error) error {
+	return ReportError(ctx, k.starlify, err)
+}
+
+// ClearError clears the error shown on the agent of the system after a successful sync.
+func (k *KafkaTopicsToStarlify) ClearError(ctx context.Context) error {
+	return ClearError(ctx, k.starlify)
+}
@@ -0,0 +1,60 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaTopicsToStarlify_ReportError(t *testing.T) {
+
+	k, _, s := newSync(t, nil, nil)
+	ctx := context.Background()
+	patches := func() int {
+		return s.Requests(http.MethodPatch, "/agents/:id")
+	}
+
+	// A restart may leave an error of the previous run, which the first successful cycle clears.
+	assert.NoError(t, k.starlify.ReportError(ctx, "[KAFKA_ERROR] stale"))
+	assert.NoError(t, k.ClearError(ctx))
+	assert.Empty(t, s.AgentError(agentId))
+	assert.NoError(t, k.ClearError(ctx))
+	assert.Equal(t, 2, patches())
+
+	err := fmt.Errorf("sync: %w", NewError(KafkaError, errors.New("broker down")))
+	assert.NoError(t, k.ReportError(ctx, err))
+	assert.Equal(t, "[KAFKA_ERROR] sync: broker down", s.AgentError(agentId))
+	assert.Equal(t, 3, patches())
+
+	// The same error is not reported again, and pings keep it.
+	assert.NoError(t, k.ReportError(ctx, err))
+	assert.NoError(t, k.Ping(ctx))
+	assert.Equal(t, "[KAFKA_ERROR] sync: broker down", s.AgentError(agentId))
+	assert.Equal(t, 4, patches())
+
+	assert.NoError(t, k.ReportError(ctx, NewError(ConfigError, errors.New("invalid prefix"))))
+	assert.Equal(t, "[CONFIG_ERROR] invalid prefix", s.AgentError(agentId))
+
+	assert.NoError(t, k.ClearError(ctx))
+	assert.Empty(t, s.AgentError(agentId))
+	assert.NoError(t, k.ClearError(ctx))
+	assert.Equal(t, 6, patches())
+}
+
+func TestKafkaTopicsToStarlify_ReportError_Failed(t *testing.T) {
+
+	k, _, s := newSync(t, nil, nil)
+	ctx := context.Background()
+	err := NewError(KafkaError, errors.New("broker down"))
+
+	// An error that could not be reported is reported again next time.
+	s.ApiKey = "wrong"
+	assert.Error(t, k.ReportError(ctx, err))
+	s.ApiKey = "api-key-123"
+	assert.NoError(t, k.ReportError(ctx, err))
+	assert.Equal(t, "[KAFKA_ERROR] broker down", s.AgentError(agentId))
+}
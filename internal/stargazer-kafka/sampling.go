@@ -0,0 +1,168 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/payload"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// AttributePayloadPrefix starts the names of the attributes inferred from sampled records, e.g. payload.format.
+const AttributePayloadPrefix = "payload."
+
+// Attributes inferred from sampled records.
+const (
+	AttributePayloadFormat    = AttributePayloadPrefix + "format"
+	AttributePayloadKeyFormat = AttributePayloadPrefix + "key.format"
+	AttributePayloadStructure = AttributePayloadPrefix + "structure"
+	AttributePayloadHeaders   = AttributePayloadPrefix + "headers"
+	AttributePayloadSampled   = AttributePayloadPrefix + "sampled"
+)
+
+// Sampling configures reading the latest records of topics without schemas to infer their payload.
+type Sampling struct {
+	// Records is the number of records to sample from each topic.
+	Records int
+	// Interval is how long a sample is used before the topic is sampled again.
+	Interval time.Duration
+	// Timeout bounds the sampling of each topic.
+	Timeout time.Duration
+	// MaxTopics is the number of topics sampled per sync, unbounded if 0. The other topics due keep their
+	// payload attributes and are sampled in the following syncs.
+	MaxTopics int
+}
+
+type sample struct {
+	at         time.Time
+	attributes []starlify.Attribute
+}
+
+// samples are the attributes of the last sample of each topic, by system and topic, since systems are
+// created again every cycle.
+var (
+	samplesMu sync.Mutex
+	samples   = make(map[string]map[string]sample)
+)
+
+// SetSampling turns sampling of topic payloads on, or off with nil sampling.
+func (k *KafkaTopicsToStarlify) SetSampling(sampling *Sampling) {
+	k.sampling = sampling
+}
+
+// getPayloadAttributes returns the attributes inferred from a sample of the latest records of the topic,
+// none if it has no records.
+func (k *KafkaTopicsToStarlify) getPayloadAttributes(ctx context.Context, topic string) ([]starlify.Attribute, error) {
+
+	if k.sampling.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, k.sampling.Timeout)
+		defer cancel()
+	}
+
+	records, err := k.kafka.SampleRecords(ctx, topic, k.sampling.Records)
+	if err != nil {
+		return nil, NewError(KafkaError, fmt.Errorf("failed to sample records of %s with error: %v", topic, err))
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	summary := payload.Summarize(records)
+	attributes := []starlify.Attribute{
+		{Name: AttributePayloadSampled, Value: strconv.Itoa(summary.Records)},
+	}
+	if summary.Format != "" {
+		attributes = append(attributes, starlify.Attribute{Name: AttributePayloadFormat, Value: summary.Format})
+	}
+	if summary.KeyFormat != "" {
+		attributes = append(attributes, starlify.Attribute{Name: AttributePayloadKeyFormat, Value: summary.KeyFormat})
+	}
+	if summary.Structure != "" {
+		attributes = append(attributes, starlify.Attribute{Name: AttributePayloadStructure, Value: summary.Structure})
+	}
+	if len(summary.Headers) > 0 {
+		attributes = append(attributes, starlify.Attribute{Name: AttributePayloadHeaders, Value: strings.Join(summary.Headers, ",")})
+	}
+	return attributes, nil
+}
+
+// addPayloadAttributes adds the attributes inferred from samples to the attributes of the topics without schema
+// attributes. Topics are sampled again after the interval, at most MaxTopics per sync. If sampling a topic fails
+// or has to wait, the payload attributes its endpoint already has are kept.
+func (k *KafkaTopicsToStarlify) addPayloadAttributes(ctx context.Context, endpoints []starlify.TopicEndpoint, topics []string, attributes map[string][]starlify.Attribute) {
+
+	if k.sampling == nil {
+		return
+	}
+
+	current := make(map[string][]starlify.Attribute)
+	for _, endpoint := range endpoints {
+		for _, attribute := range endpoint.Attributes {
+			if strings.HasPrefix(attribute.Name, AttributePayloadPrefix) {
+				current[endpoint.Topic] = append(current[endpoint.Topic], attribute)
+			}
+		}
+	}
+
+	samplesMu.Lock()
+	previous := samples[k.name]
+	samplesMu.Unlock()
+
+	now := time.Now()
+	sampled := make(map[string]sample)
+	var n, waiting int
+	for _, topic := range topics {
+		if _, ok := attributes[topic]; !ok || hasSchema(attributes[topic]) {
+			continue
+		}
+
+		s, ok := previous[topic]
+		if !ok || now.Sub(s.at) >= k.sampling.Interval {
+			if k.sampling.MaxTopics > 0 && n >= k.sampling.MaxTopics {
+				waiting++
+				if ok {
+					sampled[topic] = s
+				}
+				attributes[topic] = append(attributes[topic], current[topic]...)
+				continue
+			}
+			n++
+			payloadAttributes, err := k.getPayloadAttributes(ctx, topic)
+			if err != nil {
+				log.Ctx(ctx).Errorf("Keeping the payload of %s: %v", topic, err)
+				metrics.Errors.WithLabelValues(k.name, KafkaError).Inc()
+				attributes[topic] = append(attributes[topic], current[topic]...)
+				continue
+			}
+			s = sample{at: now, attributes: payloadAttributes}
+		}
+		sampled[topic] = s
+		attributes[topic] = append(attributes[topic], s.attributes...)
+	}
+
+	if waiting > 0 {
+		log.Ctx(ctx).Infof("Sampled %d topics, %d more are sampled in the next syncs", n, waiting)
+	}
+
+	samplesMu.Lock()
+	samples[k.name] = sampled
+	samplesMu.Unlock()
+}
+
+// hasSchema reports whether the attributes include a schema from the Schema Registry.
+func hasSchema(attributes []starlify.Attribute) bool {
+
+	for _, attribute := range attributes {
+		if strings.HasPrefix(attribute.Name, AttributeSchemaPrefix) {
+			return true
+		}
+	}
+	return false
+}
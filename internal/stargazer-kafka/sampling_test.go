@@ -0,0 +1,71 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka"
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/entiros/stargazer-kafka/internal/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTopicsToStarlify_Sampling(t *testing.T) {
+
+	k, cluster, s := newSync(t, nil, nil)
+	k.SetAttributes(true)
+	cluster.AddTopic(prefix+"orders", fake.Topic{Records: []kafka.Record{
+		{Key: []byte("1"), Value: []byte(`{"id":1}`), Headers: []kafka.Header{{Key: "trace-id"}}},
+		{Key: []byte("2"), Value: []byte(`{"id":2,"total":9.5}`)},
+	}})
+	cluster.AddTopic(prefix+"empty", fake.Topic{})
+	k.SetSampling(&Sampling{Records: 10, Interval: time.Hour})
+
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+
+	orders := s.Attributes(middlewareId, prefix+"orders")
+	assert.Equal(t, payload.JSON, orders[AttributePayloadFormat])
+	assert.Equal(t, payload.Text, orders[AttributePayloadKeyFormat])
+	assert.Equal(t, `{"id":"number","total":"number"}`, orders[AttributePayloadStructure])
+	assert.Equal(t, "trace-id", orders[AttributePayloadHeaders])
+	assert.Equal(t, "2", orders[AttributePayloadSampled])
+	assert.NotContains(t, s.Attributes(middlewareId, prefix+"empty"), AttributePayloadFormat)
+	assert.Equal(t, 2, cluster.Calls(fake.SampleRecords))
+
+	// Topics are not sampled again within the interval, and payloads are kept when sampling fails.
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cluster.Calls(fake.SampleRecords))
+
+	k.SetSampling(&Sampling{Records: 10})
+	cluster.Fail(fake.SampleRecords, errors.New("broker unavailable"))
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, payload.JSON, s.Attributes(middlewareId, prefix+"orders")[AttributePayloadFormat])
+}
+
+func TestSyncTopicsToStarlify_SamplingMaxTopics(t *testing.T) {
+
+	k, cluster, s := newSync(t, nil, nil)
+	k.SetAttributes(true)
+	for _, topic := range []string{"a", "b", "c"} {
+		cluster.AddTopic(prefix+topic, fake.Topic{Records: []kafka.Record{{Value: []byte(`{"id":1}`)}}})
+	}
+	k.SetSampling(&Sampling{Records: 10, Interval: time.Hour, MaxTopics: 2})
+
+	// Topics beyond the limit are sampled in the next syncs.
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cluster.Calls(fake.SampleRecords))
+	assert.Equal(t, payload.JSON, s.Attributes(middlewareId, prefix+"b")[AttributePayloadFormat])
+	assert.NotContains(t, s.Attributes(middlewareId, prefix+"c"), AttributePayloadFormat)
+
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cluster.Calls(fake.SampleRecords))
+	assert.Equal(t, payload.JSON, s.Attributes(middlewareId, prefix+"c")[AttributePayloadFormat])
+	assert.Equal(t, payload.JSON, s.Attributes(middlewareId, prefix+"a")[AttributePayloadFormat])
+}
@@ -0,0 +1,110 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// AttributeSchemaPrefix starts the names of schema attributes, e.g. schema.value.version.
+const AttributeSchemaPrefix = "schema."
+
+// Schemas configures publishing the schemas of topics as endpoint attributes.
+type Schemas struct {
+	Registry *schemaregistry.Client
+	// Strategy is schemaregistry.TopicNameStrategy or schemaregistry.TopicRecordNameStrategy.
+	Strategy string
+	// Subjects are templates of subject names, e.g. {topic}-value, used instead of Strategy if set.
+	Subjects []string
+	// IncludeSchema adds the schema itself, not just its type, version and compatibility.
+	IncludeSchema bool
+	// Lifecycle, if set, ties subjects to the topics created and deleted in starlify_to_kafka.
+	Lifecycle *SubjectLifecycle
+}
+
+// SetSchemas turns publishing of topic schemas on, or off with nil schemas.
+func (k *KafkaTopicsToStarlify) SetSchemas(schemas *Schemas) {
+	k.schemas = schemas
+}
+
+// getSchemaAttributes returns the attributes of the latest schemas of each topic that has subjects, by topic name.
+// For each subject, schema.{role}.subject, .type, .version, .id and .compatibility are set, and schema.{role}
+// to the schema if it is included. The role is key or value for the topic name strategy.
+func (k *KafkaTopicsToStarlify) getSchemaAttributes(ctx context.Context, topics []string) (map[string][]starlify.Attribute, error) {
+
+	registry := k.schemas.Registry
+	subjects, err := registry.Subjects(ctx)
+	if err != nil {
+		return nil, NewError(SchemaRegistryError, fmt.Errorf("failed to get subjects from Schema Registry with error: %v", err))
+	}
+
+	attributes := make(map[string][]starlify.Attribute)
+	for _, topic := range topics {
+		for subject, role := range schemaregistry.Subjects(topic, subjects, k.schemas.Strategy, k.schemas.Subjects) {
+			schema, err := registry.Latest(ctx, subject)
+			if errors.Is(err, schemaregistry.ErrNotFound) {
+				// Deleted since listed.
+				continue
+			}
+			if err != nil {
+				return nil, NewError(SchemaRegistryError, err)
+			}
+			compatibility, err := registry.Compatibility(ctx, subject)
+			if err != nil && !errors.Is(err, schemaregistry.ErrNotFound) {
+				return nil, NewError(SchemaRegistryError, err)
+			}
+
+			name := AttributeSchemaPrefix + role
+			attributes[topic] = append(attributes[topic],
+				starlify.Attribute{Name: name + ".subject", Value: subject},
+				starlify.Attribute{Name: name + ".type", Value: schema.Type()},
+				starlify.Attribute{Name: name + ".version", Value: strconv.Itoa(schema.Version)},
+				starlify.Attribute{Name: name + ".id", Value: strconv.Itoa(schema.Id)},
+			)
+			if compatibility != "" {
+				attributes[topic] = append(attributes[topic], starlify.Attribute{Name: name + ".compatibility", Value: compatibility})
+			}
+			if k.schemas.IncludeSchema {
+				attributes[topic] = append(attributes[topic], starlify.Attribute{Name: name, Value: schema.Schema})
+			}
+		}
+	}
+	return attributes, nil
+}
+
+// addSchemaAttributes adds the schema attributes of the topics to attributes. If the registry fails, the schema
+// attributes the endpoints already have are kept instead, so that a registry outage does not remove them.
+func (k *KafkaTopicsToStarlify) addSchemaAttributes(ctx context.Context, endpoints []starlify.TopicEndpoint, topics []string, attributes map[string][]starlify.Attribute) {
+
+	if k.schemas == nil {
+		return
+	}
+
+	schemaAttributes, err := k.getSchemaAttributes(ctx, topics)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Keeping the schemas of the endpoints: %v", err)
+		metrics.Errors.WithLabelValues(k.name, SchemaRegistryError).Inc()
+
+		schemaAttributes = make(map[string][]starlify.Attribute)
+		for _, endpoint := range endpoints {
+			for _, attribute := range endpoint.Attributes {
+				if strings.HasPrefix(attribute.Name, AttributeSchemaPrefix) {
+					schemaAttributes[endpoint.Topic] = append(schemaAttributes[endpoint.Topic], attribute)
+				}
+			}
+		}
+	}
+
+	for topic, schema := range schemaAttributes {
+		if _, ok := attributes[topic]; ok {
+			attributes[topic] = append(attributes[topic], schema...)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
+	registryfake "github.com/entiros/stargazer-kafka/internal/schemaregistry/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTopicsToStarlify_Schemas(t *testing.T) {
+
+	k, _, s := newSync(t, []string{prefix + "orders", prefix + "payments"}, []string{prefix + "orders"})
+	k.SetAttributes(true)
+
+	registry := registryfake.New()
+	registry.Register(prefix+"orders-value", schemaregistry.Avro, `{"type":"string"}`)
+	registry.Register(prefix+"orders-key", schemaregistry.JSONSchema, `{"type":"integer"}`)
+	registry.SetCompatibility(prefix+"orders-value", "FULL")
+	srv := httptest.NewServer(registry.Handler())
+	t.Cleanup(srv.Close)
+
+	k.SetSchemas(&Schemas{
+		Registry:      &schemaregistry.Client{URL: srv.URL},
+		Strategy:      schemaregistry.TopicNameStrategy,
+		IncludeSchema: true,
+	})
+
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+
+	orders := s.Attributes(middlewareId, prefix+"orders")
+	assert.Equal(t, prefix+"orders-value", orders["schema.value.subject"])
+	assert.Equal(t, schemaregistry.Avro, orders["schema.value.type"])
+	assert.Equal(t, "1", orders["schema.value.version"])
+	assert.Equal(t, "FULL", orders["schema.value.compatibility"])
+	assert.Equal(t, `{"type":"string"}`, orders["schema.value"])
+	assert.Equal(t, schemaregistry.JSONSchema, orders["schema.key.type"])
+	assert.Equal(t, "BACKWARD", orders["schema.key.compatibility"])
+	assert.NotEmpty(t, orders[AttributePartitions])
+	assert.NotContains(t, s.Attributes(middlewareId, prefix+"payments"), "schema.value")
+
+	// A new version is published.
+	registry.Register(prefix+"orders-value", schemaregistry.Avro, `{"type":"long"}`)
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "2", s.Attributes(middlewareId, prefix+"orders")["schema.value.version"])
+
+	// Schemas are kept while the registry is down.
+	registry.Fail(http.StatusServiceUnavailable)
+	patches := s.Requests(http.MethodPatch, "/endpoints/:id")
+	_, err = k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, patches, s.Requests(http.MethodPatch, "/endpoints/:id"))
+	assert.Equal(t, "2", s.Attributes(middlewareId, prefix+"orders")["schema.value.version"])
+}
+
+func TestSyncTopicsToStarlify_SchemasOfPrefixTopic(t *testing.T) {
+
+	k, _, s := newSync(t, []string{prefix + "orders", prefix + "orders-archive"}, nil)
+	k.SetAttributes(true)
+
+	registry := registryfake.New()
+	registry.Register(prefix+"orders-com.acme.Order", schemaregistry.Avro, `{"type":"string"}`)
+	registry.Register(prefix+"orders-archive-com.acme.Archived", schemaregistry.Avro, `{"type":"long"}`)
+	srv := httptest.NewServer(registry.Handler())
+	t.Cleanup(srv.Close)
+
+	k.SetSchemas(&Schemas{
+		Registry: &schemaregistry.Client{URL: srv.URL},
+		Strategy: schemaregistry.TopicRecordNameStrategy,
+	})
+
+	// The subjects of orders-archive are not published on orders.
+	_, err := k.SyncTopicsToStarlify(context.Background())
+	assert.NoError(t, err)
+	orders := s.Attributes(middlewareId, prefix+"orders")
+	assert.Equal(t, prefix+"orders-com.acme.Order", orders["schema.com.acme.Order.subject"])
+	assert.NotContains(t, orders, "schema.archive-com.acme.Archived.subject")
+	assert.Equal(t, prefix+"orders-archive-com.acme.Archived", s.Attributes(middlewareId, prefix+"orders-archive")["schema.com.acme.Archived.subject"])
+}
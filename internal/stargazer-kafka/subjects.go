@@ -0,0 +1,241 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/entiros/stargazer-kafka/internal/audit"
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+)
+
+// Actions on subjects.
+const (
+	SubjectRegister      = "register"
+	SubjectCompatibility = "compatibility"
+	SubjectDelete        = "delete"
+)
+
+// SubjectLifecycle registers the initial schema of topics created from Starlify, and soft deletes
+// the subjects of topics deleted.
+type SubjectLifecycle struct {
+	// SchemaAttribute is the endpoint attribute with the initial schema of the value subject. The attributes
+	// SchemaAttribute.type and SchemaAttribute.compatibility are its type, Avro if not set, and compatibility.
+	SchemaAttribute string
+	// Compatibility is set on registered subjects whose endpoint has none. Empty leaves it to the registry.
+	Compatibility string
+	// DryRun logs the plan instead of changing the registry.
+	DryRun bool
+}
+
+// pendingSubjects are the created topics whose subjects are not registered yet, e.g. because the registry was
+// down, by system and topic. Systems are created again every cycle, so they live here and are retried every sync.
+var (
+	pendingMu       sync.Mutex
+	pendingSubjects = make(map[string]map[string]bool)
+)
+
+// SubjectAction is a planned change of a subject.
+type SubjectAction struct {
+	Action  string
+	Topic   string
+	Subject string
+	// Value is the schema type to register or the compatibility level to set.
+	Value string
+
+	schema string
+}
+
+// event returns the audit event of the action.
+func (a SubjectAction) event() audit.Event {
+
+	state := &audit.State{Name: a.Subject, Topic: a.Topic}
+	switch a.Action {
+	case SubjectRegister:
+		state.Attributes = map[string]string{"type": a.Value, "schema": a.schema}
+		return audit.Event{Action: audit.SubjectRegister, Target: a.Subject, After: state}
+	case SubjectCompatibility:
+		state.Attributes = map[string]string{"compatibility": a.Value}
+		return audit.Event{Action: audit.SubjectConfig, Target: a.Subject, After: state}
+	default:
+		return audit.Event{Action: audit.SubjectDelete, Target: a.Subject, Before: state}
+	}
+}
+
+func (a SubjectAction) String() string {
+	if a.Value != "" {
+		return fmt.Sprintf("%s %s %s of topic %s", a.Action, a.Subject, a.Value, a.Topic)
+	}
+	return fmt.Sprintf("%s %s of topic %s", a.Action, a.Subject, a.Topic)
+}
+
+// valueSubject returns the subject of the values of the topic, the first subject template if there are any.
+func (s *Schemas) valueSubject(topic string) string {
+	if len(s.Subjects) > 0 {
+		return strings.ReplaceAll(s.Subjects[0], "{topic}", topic)
+	}
+	return topic + "-value"
+}
+
+// planSubjects returns the actions that register the initial schemas of the created topics whose value subject
+// is missing, and delete the subjects of the deleted topics. Subjects of topics that already existed are left
+// alone, so a subject deleted on purpose is not registered again.
+func (k *KafkaTopicsToStarlify) planSubjects(ctx context.Context, endpoints []starlify.TopicEndpoint, created []string, deleted []string) ([]SubjectAction, error) {
+
+	lifecycle := k.schemas.Lifecycle
+	subjects, err := k.schemas.Registry.Subjects(ctx)
+	if err != nil {
+		return nil, NewError(SchemaRegistryError, fmt.Errorf("failed to get subjects from Schema Registry with error: %v", err))
+	}
+	existing := make(map[string]bool)
+	for _, subject := range subjects {
+		existing[subject] = true
+	}
+
+	isCreated := make(map[string]bool)
+	for _, topic := range created {
+		isCreated[topic] = true
+	}
+
+	var plan []SubjectAction
+	for _, endpoint := range endpoints {
+		if !isCreated[endpoint.Topic] {
+			continue
+		}
+		values := attributeValues(endpoint.Attributes)
+		schema := values[lifecycle.SchemaAttribute]
+		subject := k.schemas.valueSubject(endpoint.Topic)
+		if schema == "" || existing[subject] {
+			continue
+		}
+
+		schemaType := values[lifecycle.SchemaAttribute+".type"]
+		if schemaType == "" {
+			schemaType = schemaregistry.Avro
+		}
+		plan = append(plan, SubjectAction{Action: SubjectRegister, Topic: endpoint.Topic, Subject: subject, Value: schemaType, schema: schema})
+
+		compatibility := values[lifecycle.SchemaAttribute+".compatibility"]
+		if compatibility == "" {
+			compatibility = lifecycle.Compatibility
+		}
+		if compatibility != "" {
+			plan = append(plan, SubjectAction{Action: SubjectCompatibility, Topic: endpoint.Topic, Subject: subject, Value: compatibility})
+		}
+	}
+
+	for _, topic := range deleted {
+		for subject := range schemaregistry.Subjects(topic, subjects, k.schemas.Strategy, k.schemas.Subjects) {
+			plan = append(plan, SubjectAction{Action: SubjectDelete, Topic: topic, Subject: subject})
+		}
+	}
+	return plan, nil
+}
+
+// updateSubjects is syncSubjects for a sync, which does not fail when the registry does.
+func (k *KafkaTopicsToStarlify) updateSubjects(ctx context.Context, prefix string, endpoints []starlify.TopicEndpoint, created []string, deleted []string) {
+
+	_, err := k.syncSubjects(ctx, prefix, endpoints, created, deleted)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Failed to update subjects: %v", err)
+		metrics.Errors.WithLabelValues(k.name, SchemaRegistryError).Inc()
+	}
+}
+
+// syncSubjects registers and deletes subjects along with the topics, or only logs what it would do in a dry run.
+// It returns the plan, which is applied in order until an action fails. The subjects of created topics that
+// could not be registered are registered in a later sync.
+func (k *KafkaTopicsToStarlify) syncSubjects(ctx context.Context, prefix string, endpoints []starlify.TopicEndpoint, created []string, deleted []string) ([]SubjectAction, error) {
+
+	if k.schemas == nil || k.schemas.Lifecycle == nil {
+		return nil, nil
+	}
+
+	created = k.withPendingSubjects(created, deleted)
+	plan, err := k.planSubjects(ctx, endpoints, created, deleted)
+	if err != nil {
+		k.setPendingSubjects(created)
+		return nil, err
+	}
+
+	registry := k.schemas.Registry
+	for i, action := range plan {
+		if k.schemas.Lifecycle.DryRun {
+			log.Ctx(ctx).Infof("Dry run, would %v", action)
+			continue
+		}
+
+		log.Ctx(ctx).Infof("Subject action: %v", action)
+		switch action.Action {
+		case SubjectRegister:
+			_, err = registry.Register(ctx, action.Subject, action.Value, action.schema)
+		case SubjectCompatibility:
+			err = registry.SetCompatibility(ctx, action.Subject, action.Value)
+		case SubjectDelete:
+			err = registry.DeleteSubject(ctx, action.Subject)
+		}
+		if err != nil {
+			var failed []string
+			for _, a := range plan[i:] {
+				if a.Action != SubjectDelete {
+					failed = append(failed, a.Topic)
+				}
+			}
+			k.setPendingSubjects(failed)
+			return plan, NewError(SchemaRegistryError, fmt.Errorf("failed to %v. %v", action, err))
+		}
+		metrics.SubjectsChanged.WithLabelValues(k.name, action.Action).Inc()
+		k.record(ctx, prefix, action.event())
+	}
+	k.setPendingSubjects(nil)
+	return plan, nil
+}
+
+// withPendingSubjects returns the created topics and the topics still pending from earlier syncs that were
+// not deleted since.
+func (k *KafkaTopicsToStarlify) withPendingSubjects(created []string, deleted []string) []string {
+
+	pendingMu.Lock()
+	pending := pendingSubjects[k.name]
+	pendingMu.Unlock()
+
+	topics := make(map[string]bool)
+	for _, topic := range created {
+		topics[topic] = true
+	}
+	for topic := range pending {
+		topics[topic] = true
+	}
+	for _, topic := range deleted {
+		delete(topics, topic)
+	}
+
+	var all []string
+	for topic := range topics {
+		all = append(all, topic)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// setPendingSubjects replaces the topics whose subjects are retried in the next sync.
+func (k *KafkaTopicsToStarlify) setPendingSubjects(topics []string) {
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if len(topics) == 0 {
+		delete(pendingSubjects, k.name)
+		return
+	}
+	pending := make(map[string]bool)
+	for _, topic := range topics {
+		pending[topic] = true
+	}
+	pendingSubjects[k.name] = pending
+}
@@ -0,0 +1,118 @@
+package stargazer_kafka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
+	registryfake "github.com/entiros/stargazer-kafka/internal/schemaregistry/fake"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTopicsToKafka_Subjects(t *testing.T) {
+
+	k, cluster, s := newSync(t, []string{prefix + "stale"}, []string{prefix + "orders", prefix + "payments"})
+	assert.NoError(t, s.SetAttributes(middlewareId, prefix+"orders", map[string]string{
+		"value.schema":               `{"type":"record","name":"Order","fields":[]}`,
+		"value.schema.compatibility": "FULL",
+	}))
+	assert.NoError(t, s.SetAttributes(middlewareId, prefix+"payments", map[string]string{
+		"value.schema":      `{"type":"object"}`,
+		"value.schema.type": schemaregistry.JSONSchema,
+	}))
+
+	registry := registryfake.New()
+	registry.Register(prefix+"stale-value", schemaregistry.Avro, `{"type":"string"}`)
+	registry.Register(prefix+"stale-key", schemaregistry.Avro, `{"type":"long"}`)
+	srv := httptest.NewServer(registry.Handler())
+	t.Cleanup(srv.Close)
+
+	lifecycle := &SubjectLifecycle{SchemaAttribute: "value.schema", Compatibility: "BACKWARD_TRANSITIVE", DryRun: true}
+	k.SetSchemas(&Schemas{
+		Registry:  &schemaregistry.Client{URL: srv.URL},
+		Strategy:  schemaregistry.TopicNameStrategy,
+		Lifecycle: lifecycle,
+	})
+
+	// A dry run plans the changes without making them.
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "orders", prefix + "payments"}, cluster.Topics())
+	assert.Equal(t, []string{prefix + "stale-key", prefix + "stale-value"}, registry.Subjects())
+
+	// Missing subjects of created topics are registered, and the subjects of deleted topics deleted.
+	lifecycle.DryRun = false
+	_, err = cluster.DeleteTopics(context.Background(), prefix+"orders", prefix+"payments")
+	assert.NoError(t, err)
+	cluster.AddTopic(prefix+"stale", fake.Topic{})
+	_, err = k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "orders-value", prefix + "payments-value"}, registry.Subjects())
+	assert.True(t, registry.Deleted(prefix+"stale-value"))
+	assert.True(t, registry.Deleted(prefix+"stale-key"))
+	assert.Equal(t, "FULL", registry.SubjectCompatibility(prefix+"orders-value"))
+	assert.Equal(t, "BACKWARD_TRANSITIVE", registry.SubjectCompatibility(prefix+"payments-value"))
+
+	// Subjects of topics that already exist are not registered again once deleted.
+	assert.NoError(t, (&schemaregistry.Client{URL: srv.URL}).DeleteSubject(context.Background(), prefix+"orders-value"))
+	_, err = k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "payments-value"}, registry.Subjects())
+}
+
+func TestSyncTopicsToKafka_SubjectsRetried(t *testing.T) {
+
+	k, _, s := newSync(t, nil, []string{prefix + "orders"})
+	assert.NoError(t, s.SetAttributes(middlewareId, prefix+"orders", map[string]string{
+		"value.schema": `{"type":"record","name":"Order","fields":[]}`,
+	}))
+
+	registry := registryfake.New()
+	srv := httptest.NewServer(registry.Handler())
+	t.Cleanup(srv.Close)
+	k.SetSchemas(&Schemas{
+		Registry:  &schemaregistry.Client{URL: srv.URL},
+		Strategy:  schemaregistry.TopicNameStrategy,
+		Lifecycle: &SubjectLifecycle{SchemaAttribute: "value.schema"},
+	})
+
+	// The subject of a topic created while the registry is down is registered once it is back.
+	registry.Fail(http.StatusServiceUnavailable)
+	failures := metrics.Errors.WithLabelValues(t.Name(), SchemaRegistryError)
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(failures))
+
+	registry.Fail(0)
+	_, err = k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "orders-value"}, registry.Subjects())
+}
+
+func TestSyncTopicsToKafka_SubjectsOfPrefixTopic(t *testing.T) {
+
+	k, _, _ := newSync(t, []string{prefix + "orders", prefix + "orders-archive"}, []string{prefix + "orders-archive"})
+
+	registry := registryfake.New()
+	registry.Register(prefix+"orders-com.acme.Order", schemaregistry.Avro, `{"type":"string"}`)
+	registry.Register(prefix+"orders-archive-com.acme.Order", schemaregistry.Avro, `{"type":"string"}`)
+	registry.Register(prefix+"orders-archive-value", schemaregistry.Avro, `{"type":"string"}`)
+	srv := httptest.NewServer(registry.Handler())
+	t.Cleanup(srv.Close)
+	k.SetSchemas(&Schemas{
+		Registry:  &schemaregistry.Client{URL: srv.URL},
+		Strategy:  schemaregistry.TopicRecordNameStrategy,
+		Lifecycle: &SubjectLifecycle{SchemaAttribute: "value.schema"},
+	})
+
+	// Deleting orders leaves the subjects of orders-archive alone.
+	_, err := k.SyncTopicsToKafka(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, registry.Deleted(prefix+"orders-com.acme.Order"))
+	assert.Equal(t, []string{prefix + "orders-archive-com.acme.Order", prefix + "orders-archive-value"}, registry.Subjects())
+}
@@ -0,0 +1,601 @@
+// Package fake is an in-memory Starlify hypermedia API with the parts used by the agent:
+// agents, middlewares with a Kafka prefix, endpoints and their consumers, services and error reporting.
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/gin-gonic/gin"
+)
+
+// BasePath is where the API is served, the base URL of a client is the server URL followed by BasePath.
+const BasePath = "/hypermedia"
+
+// DefaultPageSize is the page size of paged listings.
+var DefaultPageSize = 20
+
+type agent struct {
+	agent   starlify.Agent
+	err     string
+	details *starlify.Details
+	seen    time.Time
+}
+
+type middleware struct {
+	id          string
+	name        string
+	kafkaPrefix string
+	endpoints   []string
+	services    []starlify.Service
+}
+
+type endpoint struct {
+	endpoint     starlify.Endpoint
+	middlewareId string
+	engagements  []starlify.Engagement
+	interactions []starlify.EndpointInteraction
+}
+
+// Server is a fake Starlify API. All methods are safe for concurrent use.
+type Server struct {
+	ApiKey   string
+	PageSize int
+
+	mu          sync.Mutex
+	nextId      int
+	agents      map[string]*agent
+	middlewares map[string]*middleware
+	endpoints   map[string]*endpoint
+	requests    map[string]int
+}
+
+// New returns an empty server accepting requests with apiKey. An empty apiKey accepts any key.
+func New(apiKey string) *Server {
+	return &Server{
+		ApiKey:      apiKey,
+		PageSize:    DefaultPageSize,
+		agents:      make(map[string]*agent),
+		middlewares: make(map[string]*middleware),
+		endpoints:   make(map[string]*endpoint),
+		requests:    make(map[string]int),
+	}
+}
+
+// AddMiddleware adds a middleware (Kafka system) with kafkaPrefix.
+func (s *Server) AddMiddleware(id string, name string, kafkaPrefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.middlewares[id] = &middleware{id: id, name: name, kafkaPrefix: kafkaPrefix}
+}
+
+// AddAgent adds an agent of agentType connected to the middleware.
+func (s *Server) AddAgent(id string, agentType string, middlewareId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.agents[id] = &agent{agent: starlify.Agent{
+		Type:         "agent",
+		Id:           id,
+		Name:         id,
+		AgentType:    agentType,
+		MiddlewareId: middlewareId,
+		Created:      time.Now(),
+		Updated:      time.Now(),
+	}}
+}
+
+// AddEndpoint adds an endpoint to the middleware and returns its id.
+func (s *Server) AddEndpoint(middlewareId string, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addEndpoint(middlewareId, name)
+}
+
+// AddProducer reports the system as producing to the endpoint.
+func (s *Server) AddProducer(endpointId string, systemId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[endpointId]
+	if !ok {
+		return fmt.Errorf("no endpoint %s", endpointId)
+	}
+	e.engagements = append(e.engagements, starlify.Engagement{
+		Type:   "engagement",
+		Id:     s.id("engagement"),
+		System: starlify.SystemReference{Type: "system", Id: systemId},
+	})
+	return nil
+}
+
+// AddConsumer reports the system as consuming from the endpoint, with consumerGroup if reported from Kafka.
+func (s *Server) AddConsumer(endpointId string, systemId string, consumerGroup string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.addInteraction(endpointId, systemId, consumerGroup)
+	return err
+}
+
+// Endpoints returns the sorted names of the endpoints of the middleware.
+func (s *Server) Endpoints(middlewareId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	if m, ok := s.middlewares[middlewareId]; ok {
+		for _, id := range m.endpoints {
+			names = append(names, s.endpoints[id].endpoint.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Consumers returns the sorted consumer groups reported as consumers of the endpoint called name.
+func (s *Server) Consumers(middlewareId string, name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var groups []string
+	if e := s.endpointByName(middlewareId, name); e != nil {
+		for _, interaction := range e.interactions {
+			if interaction.ConsumerGroup != "" {
+				groups = append(groups, interaction.ConsumerGroup)
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Attributes returns the attributes of the endpoint called name, by attribute name.
+func (s *Server) Attributes(middlewareId string, name string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := make(map[string]string)
+	if e := s.endpointByName(middlewareId, name); e != nil {
+		for _, attribute := range e.endpoint.Attributes {
+			attributes[attribute.Name] = attribute.Value
+		}
+	}
+	return attributes
+}
+
+// SetAttributes replaces the attributes of the endpoint called name, as a user editing it in Starlify would.
+func (s *Server) SetAttributes(middlewareId string, name string, attributes map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.endpointByName(middlewareId, name)
+	if e == nil {
+		return fmt.Errorf("no endpoint %s", name)
+	}
+	e.endpoint.Attributes = nil
+	for attribute, value := range attributes {
+		e.endpoint.Attributes = append(e.endpoint.Attributes, starlify.Attribute{Name: attribute, Value: value})
+	}
+	sort.Slice(e.endpoint.Attributes, func(i, j int) bool {
+		return e.endpoint.Attributes[i].Name < e.endpoint.Attributes[j].Name
+	})
+	e.endpoint.Updated = time.Now()
+	return nil
+}
+
+// AgentError returns the error last reported by the agent, empty if cleared.
+func (s *Server) AgentError(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.agents[id]; ok {
+		return a.err
+	}
+	return ""
+}
+
+// AgentDetails returns the details last reported by the agent.
+func (s *Server) AgentDetails(id string) *starlify.Details {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.agents[id]; ok {
+		return a.details
+	}
+	return nil
+}
+
+// LastSeen returns when the agent last updated itself, e.g. by a ping.
+func (s *Server) LastSeen(id string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.agents[id]; ok {
+		return a.seen
+	}
+	return time.Time{}
+}
+
+// Requests returns the number of requests served for method and route, e.g. "POST /middlewares/:id/endpoints".
+func (s *Server) Requests(method string, route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[method+" "+route]
+}
+
+// Handler returns the handler serving the API under BasePath.
+func (s *Server) Handler() http.Handler {
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	api := router.Group(BasePath)
+	api.Use(s.authorize, s.count)
+
+	api.GET("/agents/:id", s.getAgent)
+	api.PATCH("/agents/:id", s.patchAgent)
+	api.GET("/middlewares/:id", s.getMiddleware)
+	api.GET("/middlewares/:id/endpoints", s.listEndpoints)
+	api.POST("/middlewares/:id/endpoints", s.createEndpoint)
+	api.GET("/endpoints/:id", s.getEndpoint)
+	api.PATCH("/endpoints/:id", s.patchEndpoint)
+	api.DELETE("/endpoints/:id", s.deleteEndpoint)
+	api.POST("/endpoints/:id/endpointInteractions", s.createInteraction)
+	api.DELETE("/endpointInteractions/:id", s.deleteInteraction)
+	api.GET("/systems/:id/services", s.listServices)
+	api.POST("/systems/:id/services", s.createService)
+
+	return router
+}
+
+func (s *Server) authorize(c *gin.Context) {
+	if s.ApiKey != "" && c.GetHeader("X-API-KEY") != s.ApiKey {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+	}
+}
+
+func (s *Server) count(c *gin.Context) {
+	s.mu.Lock()
+	s.requests[c.Request.Method+" "+c.FullPath()[len(BasePath):]]++
+	s.mu.Unlock()
+}
+
+func (s *Server) getAgent(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[c.Param("id")]
+	if !ok {
+		notFound(c, "agent")
+		return
+	}
+	c.JSON(http.StatusOK, a.agent)
+}
+
+func (s *Server) patchAgent(c *gin.Context) {
+
+	var request starlify.AgentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[c.Param("id")]
+	if !ok {
+		notFound(c, "agent")
+		return
+	}
+	if request.Error != nil {
+		a.err = *request.Error
+	}
+	if request.Details != nil {
+		a.details = request.Details
+	}
+	a.seen = time.Now()
+	a.agent.Updated = a.seen
+	c.JSON(http.StatusOK, a.agent)
+}
+
+func (s *Server) getMiddleware(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.middlewares[c.Param("id")]
+	if !ok {
+		notFound(c, "middleware")
+		return
+	}
+	c.JSON(http.StatusOK, starlify.Middleware{
+		Type:        "middleware",
+		Id:          m.id,
+		Name:        m.name,
+		KafkaPrefix: m.kafkaPrefix,
+	})
+}
+
+func (s *Server) listEndpoints(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.middlewares[c.Param("id")]
+	if !ok {
+		notFound(c, "middleware")
+		return
+	}
+
+	var endpoints []starlify.Endpoint
+	for _, id := range m.endpoints {
+		endpoints = append(endpoints, s.endpoints[id].endpoint)
+	}
+	content, page := s.page(c, len(endpoints))
+	c.JSON(http.StatusOK, starlify.EndpointsPage{Endpoints: endpoints[content[0]:content[1]], Page: page})
+}
+
+func (s *Server) createEndpoint(c *gin.Context) {
+
+	var request starlify.EndpointRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.middlewares[c.Param("id")]; !ok {
+		notFound(c, "middleware")
+		return
+	}
+	if s.endpointByName(c.Param("id"), request.Name) != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("endpoint %s already exists", request.Name)})
+		return
+	}
+	id, _ := s.addEndpoint(c.Param("id"), request.Name)
+	s.endpoints[id].endpoint.Attributes = request.Attributes
+	c.JSON(http.StatusCreated, s.endpointResponse(s.endpoints[id]))
+}
+
+func (s *Server) getEndpoint(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[c.Param("id")]
+	if !ok {
+		notFound(c, "endpoint")
+		return
+	}
+	c.JSON(http.StatusOK, s.endpointResponse(e))
+}
+
+func (s *Server) patchEndpoint(c *gin.Context) {
+
+	var request starlify.EndpointRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[c.Param("id")]
+	if !ok {
+		notFound(c, "endpoint")
+		return
+	}
+	if request.Name != "" {
+		e.endpoint.Name = request.Name
+	}
+	if request.Attributes != nil {
+		e.endpoint.Attributes = request.Attributes
+	}
+	e.endpoint.Updated = time.Now()
+	c.JSON(http.StatusOK, s.endpointResponse(e))
+}
+
+func (s *Server) deleteEndpoint(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[c.Param("id")]
+	if !ok {
+		notFound(c, "endpoint")
+		return
+	}
+	delete(s.endpoints, e.endpoint.Id)
+	m := s.middlewares[e.middlewareId]
+	m.endpoints = remove(m.endpoints, e.endpoint.Id)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) createInteraction(c *gin.Context) {
+
+	var request starlify.EndpointInteractionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[c.Param("id")]
+	if !ok {
+		notFound(c, "endpoint")
+		return
+	}
+	for _, interaction := range e.interactions {
+		if request.ConsumerGroup != "" && interaction.ConsumerGroup == request.ConsumerGroup {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("consumer %s already exists", request.ConsumerGroup)})
+			return
+		}
+	}
+	interaction, _ := s.addInteraction(e.endpoint.Id, "", request.ConsumerGroup)
+	c.JSON(http.StatusCreated, interaction)
+}
+
+func (s *Server) deleteInteraction(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.endpoints {
+		for i, interaction := range e.interactions {
+			if interaction.Id == c.Param("id") {
+				e.interactions = append(e.interactions[:i], e.interactions[i+1:]...)
+				c.Status(http.StatusNoContent)
+				return
+			}
+		}
+	}
+	notFound(c, "endpoint interaction")
+}
+
+func (s *Server) listServices(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.middlewares[c.Param("id")]
+	if !ok {
+		notFound(c, "system")
+		return
+	}
+	content, page := s.page(c, len(m.services))
+	c.JSON(http.StatusOK, starlify.ServicesPage{Services: m.services[content[0]:content[1]], Page: page})
+}
+
+func (s *Server) createService(c *gin.Context) {
+
+	var request starlify.ServiceRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.middlewares[c.Param("id")]
+	if !ok {
+		notFound(c, "system")
+		return
+	}
+	service := starlify.Service{Id: s.id("service"), Name: request.Name}
+	m.services = append(m.services, service)
+	c.JSON(http.StatusCreated, service)
+}
+
+// page returns the bounds of the requested page of n elements.
+func (s *Server) page(c *gin.Context, n int) ([2]int, starlify.Page) {
+
+	size := s.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	number, _ := strconv.Atoi(c.Query("page"))
+
+	from := number * size
+	if from > n {
+		from = n
+	}
+	to := from + size
+	if to > n {
+		to = n
+	}
+	return [2]int{from, to}, starlify.Page{
+		Size:          size,
+		TotalElements: n,
+		TotalPages:    (n + size - 1) / size,
+		Number:        number,
+	}
+}
+
+func (s *Server) addEndpoint(middlewareId string, name string) (string, error) {
+
+	m, ok := s.middlewares[middlewareId]
+	if !ok {
+		return "", fmt.Errorf("no middleware %s", middlewareId)
+	}
+	now := time.Now()
+	e := &endpoint{
+		endpoint:     starlify.Endpoint{Type: "endpoint", Id: s.id("endpoint"), Name: name, Created: now, Updated: now},
+		middlewareId: middlewareId,
+	}
+	s.endpoints[e.endpoint.Id] = e
+	m.endpoints = append(m.endpoints, e.endpoint.Id)
+	return e.endpoint.Id, nil
+}
+
+func (s *Server) addInteraction(endpointId string, systemId string, consumerGroup string) (starlify.EndpointInteraction, error) {
+
+	e, ok := s.endpoints[endpointId]
+	if !ok {
+		return starlify.EndpointInteraction{}, fmt.Errorf("no endpoint %s", endpointId)
+	}
+	if systemId == "" {
+		systemId = e.middlewareId
+	}
+	interaction := starlify.EndpointInteraction{
+		Type:          "endpointInteraction",
+		Id:            s.id("interaction"),
+		System:        starlify.SystemReference{Type: "system", Id: systemId},
+		ConsumerGroup: consumerGroup,
+	}
+	e.interactions = append(e.interactions, interaction)
+	return interaction, nil
+}
+
+func (s *Server) endpointByName(middlewareId string, name string) *endpoint {
+
+	if m, ok := s.middlewares[middlewareId]; ok {
+		for _, id := range m.endpoints {
+			if s.endpoints[id].endpoint.Name == name {
+				return s.endpoints[id]
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) endpointResponse(e *endpoint) starlify.EndpointResponse {
+	return starlify.EndpointResponse{
+		Type:                 e.endpoint.Type,
+		Id:                   e.endpoint.Id,
+		Name:                 e.endpoint.Name,
+		Created:              e.endpoint.Created,
+		Updated:              e.endpoint.Updated,
+		CreatedByAgent:       true,
+		Attributes:           append([]starlify.Attribute(nil), e.endpoint.Attributes...),
+		Engagements:          append([]starlify.Engagement(nil), e.engagements...),
+		EndpointInteractions: append([]starlify.EndpointInteraction(nil), e.interactions...),
+	}
+}
+
+func (s *Server) id(kind string) string {
+	s.nextId++
+	return fmt.Sprintf("%s-%d", kind, s.nextId)
+}
+
+func notFound(c *gin.Context, kind string) {
+	c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s %s not found", kind, c.Param("id"))})
+}
+
+func remove(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
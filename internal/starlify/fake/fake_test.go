@@ -0,0 +1,113 @@
+package fake
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T) (*Server, *starlify.Client) {
+
+	gin.SetMode(gin.TestMode)
+
+	s := New("api-key-123")
+	s.PageSize = 2
+	s.AddMiddleware("system-id-123", "Kafka", "e12345678.")
+	s.AddAgent("agent-id-123", "managed-kafka", "system-id-123")
+
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+
+	return s, &starlify.Client{
+		BaseUrl:      srv.URL + BasePath,
+		ApiKey:       "api-key-123",
+		AgentId:      "agent-id-123",
+		MiddlewareId: "system-id-123",
+	}
+}
+
+func TestServer_Topics(t *testing.T) {
+
+	s, client := newClient(t)
+	ctx := context.Background()
+
+	_, err := s.AddEndpoint("system-id-123", "e12345678.orders")
+	assert.NoError(t, err)
+
+	for _, topic := range []string{"e12345678.payments", "e12345678.invoices", "e12345678.refunds"} {
+		assert.NoError(t, client.CreateTopic(ctx, topic))
+	}
+	assert.ErrorIs(t, client.CreateTopic(ctx, "e12345678.orders"), starlify.ErrConflict)
+
+	prefix, topics, err := client.GetMiddlewareTopics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "e12345678.", prefix)
+	assert.Len(t, topics, 4)
+	assert.Equal(t, 2, s.Requests(http.MethodGet, "/middlewares/:id/endpoints"))
+
+	assert.NoError(t, client.DeleteTopic(ctx, topics[0]))
+	assert.ErrorIs(t, client.DeleteTopic(ctx, topics[0]), starlify.ErrNotFound)
+	assert.Equal(t, []string{"e12345678.invoices", "e12345678.payments", "e12345678.refunds"}, s.Endpoints("system-id-123"))
+}
+
+func TestServer_Consumers(t *testing.T) {
+
+	s, client := newClient(t)
+	ctx := context.Background()
+
+	id, _ := s.AddEndpoint("system-id-123", "e12345678.orders")
+	endpoint := starlify.TopicEndpoint{ID: id, Name: "e12345678.orders"}
+
+	assert.NoError(t, client.CreateConsumer(ctx, endpoint, "billing"))
+	assert.Equal(t, []string{"billing"}, s.Consumers("system-id-123", "e12345678.orders"))
+
+	response, err := client.GetEndpoint(ctx, id)
+	assert.NoError(t, err)
+	assert.Len(t, response.EndpointInteractions, 1)
+
+	assert.NoError(t, client.DeleteConsumer(ctx, response.EndpointInteractions[0]))
+	assert.Empty(t, s.Consumers("system-id-123", "e12345678.orders"))
+}
+
+func TestServer_Agent(t *testing.T) {
+
+	s, client := newClient(t)
+	ctx := context.Background()
+
+	agent, err := client.GetAgent(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "managed-kafka", agent.AgentType)
+
+	assert.NoError(t, client.ReportError(ctx, "broken"))
+	assert.Equal(t, "broken", s.AgentError("agent-id-123"))
+	assert.NoError(t, client.UpdateDetails(ctx, starlify.Details{Topics: []starlify.TopicDetails{{Name: "e12345678.orders"}}}))
+	assert.Equal(t, "e12345678.orders", s.AgentDetails("agent-id-123").Topics[0].Name)
+	assert.NoError(t, client.Ping(ctx))
+	assert.Equal(t, "broken", s.AgentError("agent-id-123"))
+	assert.NoError(t, client.ClearError(ctx))
+	assert.Empty(t, s.AgentError("agent-id-123"))
+	assert.False(t, s.LastSeen("agent-id-123").IsZero())
+
+	client.ApiKey = "wrong"
+	_, err = client.GetAgent(ctx)
+	assert.ErrorIs(t, err, starlify.ErrUnauthorized)
+}
+
+func TestServer_Services(t *testing.T) {
+
+	_, client := newClient(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := client.CreateService(ctx, name)
+		assert.NoError(t, err)
+	}
+	services, err := client.GetServices(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, services, 3)
+}
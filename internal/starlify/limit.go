@@ -0,0 +1,67 @@
+package starlify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// DefaultRateLimit is the number of requests per second allowed per Starlify base URL and API key, when
+// not configured.
+var DefaultRateLimit = 10.0
+
+// DefaultBurst is the number of requests allowed at once before DefaultRateLimit applies.
+var DefaultBurst = 20
+
+// Clients are created for every sync cycle and system, so limiters are kept here
+// to be shared by all clients of the same Starlify base URL, API key, limit and burst.
+var limiters = struct {
+	sync.Mutex
+	byKey map[string]*rate.Limiter
+}{byKey: make(map[string]*rate.Limiter)}
+
+// limiter returns the shared limiter of the client's base URL, API key, limit and burst. Clients with other
+// limits have limiters of their own, so no system changes the limit of another.
+func (starlify *Client) limiter() *rate.Limiter {
+
+	limit := starlify.RateLimit
+	if limit <= 0 {
+		limit = DefaultRateLimit
+	}
+	burst := starlify.Burst
+	if burst <= 0 {
+		burst = DefaultBurst
+	}
+
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	key := fmt.Sprintf("%s\x00%s\x00%g\x00%d", starlify.BaseUrl, starlify.ApiKey, limit, burst)
+	l, ok := limiters.byKey[key]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(limit), burst)
+		limiters.byKey[key] = l
+	}
+	return l
+}
+
+// wait blocks until the limiter allows one more request and records the time spent waiting.
+func (starlify *Client) wait(ctx context.Context) error {
+
+	start := time.Now()
+	err := starlify.limiter().Wait(ctx)
+	metrics.StarlifyLimiterWait.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Concurrency returns the number of requests that may be in flight when doing many changes at once.
+func (starlify *Client) Concurrency() int {
+	if starlify.MaxConcurrent <= 0 {
+		return 1
+	}
+	return starlify.MaxConcurrent
+}
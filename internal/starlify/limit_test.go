@@ -0,0 +1,32 @@
+package starlify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestClient_LimiterIsShared(t *testing.T) {
+
+	a := &Client{BaseUrl: "http://starlify.test", ApiKey: "key-1", RateLimit: 5, Burst: 2}
+	b := &Client{BaseUrl: "http://starlify.test", ApiKey: "key-1", RateLimit: 5, Burst: 2}
+	other := &Client{BaseUrl: "http://starlify.test", ApiKey: "key-2"}
+
+	shared := a.limiter()
+	assert.Same(t, shared, b.limiter())
+	assert.NotSame(t, a.limiter(), other.limiter())
+	assert.Equal(t, rate.Limit(DefaultRateLimit), other.limiter().Limit())
+
+	// Clients with other limits do not change the limit of the shared limiter.
+	slow := &Client{BaseUrl: "http://starlify.test", ApiKey: "key-1", RateLimit: 1, Burst: 2}
+	assert.NotSame(t, shared, slow.limiter())
+	assert.Equal(t, rate.Limit(1), slow.limiter().Limit())
+	assert.Equal(t, rate.Limit(5), shared.Limit())
+	assert.Same(t, shared, a.limiter())
+}
+
+func TestClient_Concurrency(t *testing.T) {
+	assert.Equal(t, 1, (&Client{}).Concurrency())
+	assert.Equal(t, 4, (&Client{MaxConcurrent: 4}).Concurrency())
+}
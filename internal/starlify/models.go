@@ -21,9 +21,9 @@ type EndpointResponse struct {
 			Href string `json:"href"`
 		} `json:"links"`
 	} `json:"provider"`
-	Attributes           []interface{} `json:"attributes"`
-	Engagements          []interface{} `json:"engagements"`
-	EndpointInteractions []interface{} `json:"endpointInteractions"`
+	Attributes           []Attribute           `json:"attributes"`
+	Engagements          []Engagement          `json:"engagements"`
+	EndpointInteractions []EndpointInteraction `json:"endpointInteractions"`
 	Domain               struct {
 		Type  string `json:"type"`
 		Id    string `json:"id"`
@@ -49,10 +49,59 @@ type EndpointResponse struct {
 	} `json:"links"`
 }
 
-type EndpointRequest struct {
+// SystemReference is a reference to a Starlify system.
+type SystemReference struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
 	Name string `json:"name"`
 }
 
+// Engagement is a system producing to an endpoint.
+type Engagement struct {
+	Type   string          `json:"type"`
+	Id     string          `json:"id"`
+	System SystemReference `json:"system"`
+}
+
+// EndpointInteraction is a system consuming from an endpoint. Interactions reported by
+// the agent from Kafka consumer groups carry the name of the group.
+type EndpointInteraction struct {
+	Type          string          `json:"type"`
+	Id            string          `json:"id"`
+	System        SystemReference `json:"system"`
+	ConsumerGroup string          `json:"consumerGroup,omitempty"`
+}
+
+type EndpointInteractionRequest struct {
+	ConsumerGroup string `json:"consumerGroup"`
+}
+
+// Attribute is a named value describing an endpoint.
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Endpoint is an endpoint as listed on a middleware.
+type Endpoint struct {
+	Type       string      `json:"type"`
+	Id         string      `json:"id"`
+	Created    time.Time   `json:"created"`
+	Updated    time.Time   `json:"updated"`
+	Name       string      `json:"name"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+type EndpointsPage struct {
+	Endpoints []Endpoint `json:"content"`
+	Page      Page       `json:"page"`
+}
+
+type EndpointRequest struct {
+	Name       string      `json:"name"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
 type Middleware struct {
 	Type           string    `json:"type"`
 	Id             string    `json:"id"`
@@ -157,9 +206,10 @@ type Agent struct {
 	} `json:"links"`
 }
 
+// AgentRequest updates the fields of an agent that are set, leaving the error as is if Error is nil.
 type AgentRequest struct {
-	Error   string   `json:"error"`
-	Details *Details `json:"details"`
+	Error   *string  `json:"error,omitempty"`
+	Details *Details `json:"details,omitempty"`
 }
 
 type PartitionDetails struct {
@@ -172,5 +222,7 @@ type TopicDetails struct {
 }
 
 type Details struct {
-	Topics []TopicDetails `json:"topics"`
+	Topics []TopicDetails `json:"topics,omitempty"`
+	// UnmanagedPrefixes are prefixes found in the cluster that no configured system manages.
+	UnmanagedPrefixes []string `json:"unmanagedPrefixes,omitempty"`
 }
@@ -0,0 +1,247 @@
+package starlify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrConflict     = errors.New("conflict")
+	ErrIncomplete   = errors.New("incomplete listing")
+)
+
+// IncompleteError is returned when a paged listing did not add up to the total reported by Starlify.
+// Deleting anything based on such a listing is not safe.
+type IncompleteError struct {
+	Expected int
+	Received int
+	Reason   string
+}
+
+func (e *IncompleteError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("incomplete listing, %s: expected %d, received %d", e.Reason, e.Expected, e.Received)
+	}
+	return fmt.Sprintf("incomplete listing: expected %d, received %d", e.Expected, e.Received)
+}
+
+func (e *IncompleteError) Is(target error) bool {
+	return target == ErrIncomplete
+}
+
+// StatusError is returned when Starlify responds with an error status.
+// Use errors.Is with ErrNotFound, ErrUnauthorized or ErrConflict to branch on it.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Body)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// RetryPolicy controls how failed requests are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, doubled for every retry after that.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, including delays asked for by Retry-After.
+	MaxDelay time.Duration
+	// Timeout of a single attempt.
+	Timeout time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 6,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+	Timeout:    10 * time.Second,
+}
+
+func (starlify *Client) retryPolicy() RetryPolicy {
+	if starlify.Retry != nil {
+		return *starlify.Retry
+	}
+	return DefaultRetryPolicy
+}
+
+// idempotent reports whether a request with method can be repeated without changing the outcome.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether the outcome of an attempt should be retried.
+// Requests that are not idempotent are only retried when Starlify reports it did not process them.
+func retryable(method string, response *resty.Response, err error) bool {
+
+	if err != nil {
+		return idempotent(method)
+	}
+
+	switch code := response.StatusCode(); {
+	case code == http.StatusTooManyRequests, code == http.StatusServiceUnavailable:
+		return true
+	case code >= 500:
+		return idempotent(method)
+	case code == http.StatusOK && method == http.MethodGet && len(response.Body()) == 0:
+		// Starlify sometimes answers GET with an empty body, asking again usually helps.
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number attempt (starting at 0), using full jitter.
+// A Retry-After header in response takes precedence.
+func (p RetryPolicy) backoff(attempt int, response *resty.Response) time.Duration {
+
+	if response != nil {
+		if after, ok := retryAfter(response.Header().Get("Retry-After")); ok {
+			if after > p.MaxDelay {
+				return p.MaxDelay
+			}
+			return after
+		}
+	}
+
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(header string) (time.Duration, bool) {
+
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		d := time.Until(at)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// do performs a request to path, retrying as allowed by the retry policy, and parses the response into returnType.
+func (starlify *Client) do(ctx context.Context, method string, path string, body any, returnType any) (err error) {
+
+	ctx, span := startRequest(ctx, method, path)
+	defer func() { tracing.End(span, err) }()
+
+	policy := starlify.retryPolicy()
+	requestPath := starlify.BaseUrl + path
+	log.Logger.Debugf("Performing %s to: %s", method, requestPath)
+
+	var response *resty.Response
+	for attempt := 0; ; attempt++ {
+
+		err = starlify.wait(ctx)
+		if err != nil {
+			return err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+		request := starlify.RestyClient().R().
+			SetContext(attemptCtx).
+			SetHeader("X-API-KEY", starlify.ApiKey)
+		if body != nil {
+			request.SetBody(body)
+		}
+
+		start := time.Now()
+		response, err = request.Execute(method, requestPath)
+		observe(span, method, path, start, response)
+		cancel()
+
+		if attempt >= policy.MaxRetries || !retryable(method, response, err) || ctx.Err() != nil {
+			break
+		}
+
+		delay := policy.backoff(attempt, response)
+		if err != nil {
+			log.Logger.Debugf("Retry %d %s %s in %v: %v", attempt+1, method, requestPath, delay, err)
+		} else {
+			log.Logger.Debugf("Retry %d %s %s in %v: %s", attempt+1, method, requestPath, delay, response.Status())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if err != nil {
+		log.Logger.Errorf("Failed %s request to %s. error: '%v'", method, requestPath, err)
+		return err
+	}
+
+	if response.IsError() {
+		return &StatusError{
+			Method:     method,
+			Path:       path,
+			StatusCode: response.StatusCode(),
+			Status:     response.Status(),
+			Body:       string(response.Body()),
+		}
+	}
+
+	if method == http.MethodGet && len(response.Body()) < 2 {
+		return fmt.Errorf("empty response to GET %s, status: %s", requestPath, response.Status())
+	}
+
+	if returnType != nil && len(response.Body()) > 0 {
+		err = json.Unmarshal(response.Body(), returnType)
+		if err != nil {
+			log.Logger.Errorf("Failed to unmarshal response: %s. Err: %v", string(response.Body()), err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package starlify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func createRetryingClient() *Client {
+	starlify := createStarlifyClient()
+	starlify.Retry = &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, Timeout: time.Second}
+	return starlify
+}
+
+func TestClient_RetriesRateLimited(t *testing.T) {
+	defer gock.Off()
+
+	createGock().
+		Post("/middlewares/system-id-123/endpoints").
+		Reply(429).
+		SetHeader("Retry-After", "0")
+	createGock().
+		Post("/middlewares/system-id-123/endpoints").
+		Reply(201).
+		JSON(EndpointResponse{Id: "endpoint-id-123", Name: "e12345678.orders"})
+
+	err := createRetryingClient().CreateTopic(context.Background(), "e12345678.orders")
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+}
+
+func TestClient_RetriesServerErrorsWhenIdempotent(t *testing.T) {
+	defer gock.Off()
+
+	createGock().
+		Delete("/endpoints/endpoint-id-123").
+		Times(2).
+		Reply(502)
+	createGock().
+		Delete("/endpoints/endpoint-id-123").
+		Reply(204)
+
+	err := createRetryingClient().DeleteTopic(context.Background(), TopicEndpoint{ID: "endpoint-id-123"})
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+}
+
+func TestClient_DoesNotRetryPostOnServerError(t *testing.T) {
+	defer gock.Off()
+
+	createGock().
+		Post("/middlewares/system-id-123/endpoints").
+		Reply(500)
+	createGock().
+		Post("/middlewares/system-id-123/endpoints").
+		Reply(201)
+
+	err := createRetryingClient().CreateTopic(context.Background(), "e12345678.orders")
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 500, statusErr.StatusCode)
+	assert.False(t, gock.IsDone())
+}
+
+func TestClient_TypedErrors(t *testing.T) {
+	defer gock.Off()
+
+	starlify := createRetryingClient()
+
+	createGock().
+		Delete("/endpoints/endpoint-id-123").
+		Reply(404)
+	err := starlify.DeleteTopic(context.Background(), TopicEndpoint{ID: "endpoint-id-123"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	createGock().
+		Get("/agents/agent-id-123").
+		Reply(401)
+	_, err = starlify.GetAgent(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	createGock().
+		Post("/middlewares/system-id-123/endpoints").
+		Reply(409)
+	err = starlify.CreateTopic(context.Background(), "e12345678.orders")
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
+
+func TestRetryAfter(t *testing.T) {
+	d, ok := retryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = retryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+
+	_, ok = retryAfter("soon")
+	assert.False(t, ok)
+}
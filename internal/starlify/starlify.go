@@ -2,12 +2,16 @@ package starlify
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/entiros/stargazer-kafka/internal/log"
-	"github.com/entiros/stargazer-kafka/internal/prefix"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/entiros/stargazer-kafka/internal/tracing"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -18,13 +22,24 @@ type Client struct {
 	ApiKey       string
 	AgentId      string
 	MiddlewareId string
-	resty        *resty.Client
+	// Retry overrides DefaultRetryPolicy.
+	Retry *RetryPolicy
+	// RateLimit and Burst override DefaultRateLimit and DefaultBurst. They apply to all
+	// clients using the same base URL and API key.
+	RateLimit float64
+	Burst     int
+	// MaxConcurrent is the number of endpoints created at once, 1 if not set.
+	MaxConcurrent int
+	resty         *resty.Client
 }
 
 type TopicEndpoint struct {
-	Name   string
-	ID     string
-	Prefix string
+	Name string
+	// Topic is the Kafka topic name of the endpoint, set when mapped from Name.
+	Topic      string
+	ID         string
+	Prefix     string
+	Attributes []Attribute
 }
 
 func (starlify *Client) RestyClient() *resty.Client {
@@ -35,124 +50,60 @@ func (starlify *Client) RestyClient() *resty.Client {
 	return starlify.resty
 }
 
-// get performs GET request to path and return parsed response
-func (starlify *Client) get(ctx context.Context, path string, returnType any) error {
-
-	RetryCount := 6
-	Timeout := 10
-
-	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(Timeout)*time.Duration(RetryCount)+5)
-	defer cancel()
-
-	requestPath := starlify.BaseUrl + path
-	log.Logger.Debugf("Performing GET to: %s", requestPath)
-
-	var retryCounter int
+// route returns path with ids replaced by {id}, e.g. /middlewares/{id}/endpoints.
+func route(path string) string {
 
-	response, err := starlify.
-		RestyClient().
-		SetTimeout(time.Duration(Timeout)*time.Second).
-		SetRetryCount(RetryCount).
-		AddRetryCondition(func(response *resty.Response, retryErr error) bool {
-			if retryErr != nil {
-				log.Logger.Debugf("Error: %v. Retrying GET %s", retryErr, requestPath)
-				return true
-			}
-			retry := len(response.Body()) == 0 && response.StatusCode() == http.StatusOK
-			if retry {
-				retryCounter++
-				log.Logger.Debugf("Retry %d GET %s: %s/%d:  error:'%v'", retryCounter, requestPath, response.Status(), response.StatusCode(), retryErr)
-			}
-			return retry
-		}).
-		R().
-		SetContext(ctx).
-		SetHeader("X-API-KEY", starlify.ApiKey).
-		Get(requestPath)
-
-	if err != nil {
-		log.Logger.Errorf("Failed GET request to %s. error: '%v'", requestPath, err)
-		return err
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := 1; i < len(segments); i += 2 {
+		segments[i] = "{id}"
 	}
+	return "/" + strings.Join(segments, "/")
+}
 
-	if response.StatusCode() == http.StatusOK && len(response.Body()) >= 2 {
-		err = json.Unmarshal(response.Body(), &returnType)
-		if err != nil {
-			log.Logger.Errorf("Failed to unmarshal response: %s. Err: %v", string(response.Body()), err)
-			return err
-		}
+// startRequest starts the span of a request to path.
+func startRequest(ctx context.Context, method string, path string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "starlify "+method+" "+route(path),
+		attribute.String("http.method", method),
+		attribute.String("http.route", route(path)),
+	)
+}
 
-	} else {
-		return fmt.Errorf("error while performing request to %s, status: %s:%d, error: %v", response.Request.URL, response.Status(), response.StatusCode(), response.Error())
-	}
+// observe records the duration of a request attempt in the Starlify request metrics.
+func observe(span trace.Span, method string, path string, start time.Time, response *resty.Response) {
 
-	if retryCounter > 0 {
-		log.Logger.Debugf("Retry count: %d for GET %s", retryCounter, requestPath)
+	status := "error"
+	if response != nil && response.StatusCode() != 0 {
+		status = strconv.Itoa(response.StatusCode())
+		span.SetAttributes(attribute.Int("http.status_code", response.StatusCode()))
 	}
+	metrics.StarlifyRequestDuration.WithLabelValues(method, route(path), status).Observe(time.Since(start).Seconds())
+}
 
-	return nil
-
+// get performs GET request to path and return parsed response
+func (starlify *Client) get(ctx context.Context, path string, returnType any) error {
+	return starlify.do(ctx, http.MethodGet, path, nil, returnType)
 }
 
 // post performs POST request to path and return parsed response
 func (starlify *Client) post(ctx context.Context, path string, body any, returnType any) error {
-
-	resp, err := starlify.RestyClient().R().
-		SetContext(ctx).
-		SetHeader("X-API-KEY", starlify.ApiKey).
-		SetBody(body).
-		SetResult(returnType).
-		Post(starlify.BaseUrl + path)
-
-	if err != nil {
-		return err
-	}
-	if resp.IsError() {
-		return fmt.Errorf("%s", resp.Status())
-	}
-	return nil
+	return starlify.do(ctx, http.MethodPost, path, body, returnType)
 }
 
-// post performs POST request to path and return parsed response
+// delete performs DELETE request to path
 func (starlify *Client) delete(ctx context.Context, path string) error {
-
-	_, err := starlify.RestyClient().R().
-		SetContext(ctx).
-		SetHeader("X-API-KEY", starlify.ApiKey).
-		Delete(starlify.BaseUrl + path)
-	if err != nil {
-		return err
-	}
-
-	return err
+	return starlify.do(ctx, http.MethodDelete, path, nil, nil)
 }
 
 // patch performs PATCH request to path and return parsed response
 func (starlify *Client) patch(ctx context.Context, path string, body any, returnType any) error {
-
-	response, err := starlify.RestyClient().R().
-		SetContext(ctx).
-		SetHeader("X-API-KEY", starlify.ApiKey).
-		SetBody(body).
-		Patch(starlify.BaseUrl + path)
-	if err != nil {
-		return err
-	}
-
-	if response.IsError() {
-		return fmt.Errorf("%s", response.Status())
-	}
-
-	// Parse response
-	err = json.Unmarshal(response.Body(), &returnType)
-	if err != nil {
-		return err
-	}
-
-	return err
+	return starlify.do(ctx, http.MethodPatch, path, body, returnType)
 }
 
-func (starlify *Client) GetTopics(ctx context.Context) (string, []TopicEndpoint, error) {
+// GetMiddlewareTopics returns the Kafka prefix of the middleware and all of its endpoints, with or without the prefix.
+// The prefix is not validated, that is up to the prefix policy of the caller.
+// If fewer endpoints than Starlify reported were received, the endpoints are returned together with an *IncompleteError.
+func (starlify *Client) GetMiddlewareTopics(ctx context.Context) (string, []TopicEndpoint, error) {
 
 	var middleware Middleware
 	path := fmt.Sprintf("/middlewares/%s", starlify.MiddlewareId)
@@ -162,29 +113,76 @@ func (starlify *Client) GetTopics(ctx context.Context) (string, []TopicEndpoint,
 		return "", nil, err
 	}
 
-	if err := prefix.Validate(middleware.KafkaPrefix); err != nil {
-		return "", nil, err
+	endpoints, listErr := starlify.GetEndpoints(ctx)
+	if listErr != nil && !errors.Is(listErr, ErrIncomplete) {
+		return "", nil, listErr
 	}
 
 	var topics []TopicEndpoint
-	for _, endpoint := range middleware.Endpoints {
-		e := strings.TrimSpace(endpoint.Name)
-		if strings.HasPrefix(e, strings.TrimSpace(middleware.KafkaPrefix)) {
-
-			topics = append(topics, TopicEndpoint{
-				Name:   e,
-				ID:     endpoint.Id,
-				Prefix: middleware.KafkaPrefix,
-			})
+	for _, endpoint := range endpoints {
+		topics = append(topics, TopicEndpoint{
+			Name:       strings.TrimSpace(endpoint.Name),
+			ID:         endpoint.Id,
+			Prefix:     middleware.KafkaPrefix,
+			Attributes: endpoint.Attributes,
+		})
+	}
+	return middleware.KafkaPrefix, topics, listErr
+}
+
+// GetEndpoints will get all endpoints of the middleware, page by page. Endpoints are returned
+// together with an *IncompleteError if fewer unique endpoints were received than Starlify reported.
+func (starlify *Client) GetEndpoints(ctx context.Context) ([]Endpoint, error) {
+	log.Logger.Debugf("Get endpoints for middleware %s", starlify.MiddlewareId)
+
+	var endpoints []Endpoint
+	seen := make(map[string]bool)
+
+	var totalPages = 1
+	var totalElements = -1
+	for page := 0; page < totalPages; page++ {
+		log.Logger.Debugf("Fetching endpoints page %d", page)
+
+		var endpointsPage EndpointsPage
+		path := fmt.Sprintf("/middlewares/%s/endpoints?page=%d", starlify.MiddlewareId, page)
+		err := starlify.get(ctx, path, &endpointsPage)
+		if err != nil {
+			return nil, err
+		}
+
+		// Update total pages
+		totalPages = endpointsPage.Page.TotalPages
+
+		// Endpoints added or removed while paging shift the pages
+		if totalElements < 0 {
+			log.Logger.Debugf("%d endpoints to be fetched (%d pages)", endpointsPage.Page.TotalElements, totalPages)
+			totalElements = endpointsPage.Page.TotalElements
+		} else if totalElements != endpointsPage.Page.TotalElements {
+			return endpoints, &IncompleteError{Expected: totalElements, Received: len(endpoints), Reason: "endpoints changed while paging"}
+		}
+
+		for _, endpoint := range endpointsPage.Endpoints {
+			if !seen[endpoint.Id] {
+				seen[endpoint.Id] = true
+				endpoints = append(endpoints, endpoint)
+			}
 		}
 	}
-	return middleware.KafkaPrefix, topics, nil
+
+	if len(endpoints) != totalElements {
+		return endpoints, &IncompleteError{Expected: totalElements, Received: len(endpoints)}
+	}
+
+	log.Logger.Debugf("%d endpoints fetched", len(endpoints))
+	return endpoints, nil
 }
 
-func (starlify *Client) CreateTopic(ctx context.Context, topic string) error {
+// CreateTopic will create an endpoint for the topic, described by the attributes
+func (starlify *Client) CreateTopic(ctx context.Context, topic string, attributes ...Attribute) error {
 
 	endpoint := EndpointRequest{
-		Name: topic,
+		Name:       topic,
+		Attributes: attributes,
 	}
 	path := fmt.Sprintf("/middlewares/%s/endpoints", starlify.MiddlewareId)
 
@@ -194,6 +192,42 @@ func (starlify *Client) CreateTopic(ctx context.Context, topic string) error {
 
 }
 
+// UpdateAttributes will replace the attributes of the endpoint
+func (starlify *Client) UpdateAttributes(ctx context.Context, endpoint TopicEndpoint, attributes []Attribute) error {
+	log.Logger.Debugf("Update attributes of endpoint %s", endpoint.Name)
+
+	var response EndpointResponse
+	return starlify.patch(ctx, fmt.Sprintf("/endpoints/%s", endpoint.ID), &EndpointRequest{Name: endpoint.Name, Attributes: attributes}, &response)
+}
+
+// GetEndpoint will return the endpoint including its engagements and interactions
+func (starlify *Client) GetEndpoint(ctx context.Context, id string) (*EndpointResponse, error) {
+
+	var endpoint EndpointResponse
+	err := starlify.get(ctx, fmt.Sprintf("/endpoints/%s", id), &endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// CreateConsumer will report a Kafka consumer group as a consumer of the endpoint
+func (starlify *Client) CreateConsumer(ctx context.Context, endpoint TopicEndpoint, group string) error {
+	log.Logger.Debugf("Create consumer '%s' of endpoint %s", group, endpoint.Name)
+
+	path := fmt.Sprintf("/endpoints/%s/endpointInteractions", endpoint.ID)
+
+	var interaction EndpointInteraction
+	return starlify.post(ctx, path, &EndpointInteractionRequest{ConsumerGroup: group}, &interaction)
+}
+
+// DeleteConsumer will remove a consumer group interaction reported earlier
+func (starlify *Client) DeleteConsumer(ctx context.Context, interaction EndpointInteraction) error {
+	log.Logger.Debugf("Delete consumer '%s'", interaction.ConsumerGroup)
+
+	return starlify.delete(ctx, fmt.Sprintf("/endpointInteractions/%s", interaction.Id))
+}
+
 func (starlify *Client) DeleteTopic(ctx context.Context, endpoint TopicEndpoint) error {
 
 	path := fmt.Sprintf("/endpoints/%s", endpoint.ID)
@@ -281,7 +315,7 @@ func (starlify *Client) GetAgent(ctx context.Context) (*Agent, error) {
 	return &agent, nil
 }
 
-// UpdateDetails will update the agent details
+// UpdateDetails will update the agent details, leaving the error as is
 func (starlify *Client) UpdateDetails(ctx context.Context, details Details) error {
 	log.Logger.Debug("Updating details")
 	var agent Agent
@@ -295,14 +329,14 @@ func (starlify *Client) UpdateDetails(ctx context.Context, details Details) erro
 // ReportError will update the error field in the Starlify agent
 func (starlify *Client) ReportError(ctx context.Context, message string) error {
 	var agent Agent
-	err := starlify.patch(ctx, "/agents/"+starlify.AgentId, AgentRequest{Error: message}, &agent)
+	err := starlify.patch(ctx, "/agents/"+starlify.AgentId, AgentRequest{Error: &message}, &agent)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// ClearError will Starlify agent error field to empty string
+// ClearError will set the Starlify agent error field to empty string
 func (starlify *Client) ClearError(ctx context.Context) error {
 	return starlify.ReportError(ctx, "")
 }
@@ -2,12 +2,10 @@ package starlify
 
 import (
 	"context"
-	stargazerkafka "github.com/entiros/stargazer-kafka/internal/config"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/h2non/gock.v1"
-	"log"
-	"os"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -20,35 +18,11 @@ func createStarlifyClient() *Client {
 	}
 
 	// Intercept Starlify client
-	gock.InterceptClient(starlify.GetRestyClient().GetClient())
+	gock.InterceptClient(starlify.RestyClient().GetClient())
 
 	return starlify
 }
 
-func TestGetTopics(t *testing.T) {
-	config, err := stargazerkafka.LoadConfig("config/config.yml")
-	if err != nil {
-		log.Println(err)
-		os.Exit(2)
-	}
-	c := Client{
-		BaseUrl:      config.Starlify.BaseUrl,
-		ApiKey:       config.Starlify.ApiKey,
-		AgentId:      config.Starlify.AgentId,
-		MiddlewareId: config.Starlify.MiddlewareId,
-	}
-
-	_, topics, err := c.GetTopics(context.Background())
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	for _, topic := range topics {
-		t.Logf("Topic %s", topic)
-	}
-
-}
-
 func createGock() *gock.Request {
 	return gock.New("http://127.0.0.1:8080/hypermedia")
 }
@@ -67,7 +41,7 @@ func TestClient_ClearError(t *testing.T) {
 			func(gock *gock.Request) {
 				gock.Patch("/agents/agent-id-123").
 					MatchType("json").
-					JSON(AgentRequest{Error: ""}).
+					JSON(map[string]string{"error": ""}).
 					Reply(200).
 					JSON(Agent{Id: "agent-id-123", Name: "Test agent", AgentType: "kafka"})
 			},
@@ -290,6 +264,83 @@ func TestClient_GetServices(t *testing.T) {
 	}
 }
 
+func TestClient_GetMiddlewareTopicsPaged(t *testing.T) {
+	defer gock.Off()
+
+	starlify := createStarlifyClient()
+
+	middleware := func(gock *gock.Request) {
+		gock.Get("/middlewares/system-id-123").
+			Reply(200).
+			JSON(Middleware{Id: "system-id-123", KafkaPrefix: "e12345678."})
+	}
+	endpoints := func(page int, total int, pages int, names ...string) {
+		var content []Endpoint
+		for _, name := range names {
+			content = append(content, Endpoint{Id: "id-" + name, Name: name})
+		}
+		createGock().Get("/middlewares/system-id-123/endpoints").
+			MatchParam("page", strconv.Itoa(page)).
+			Reply(200).
+			JSON(EndpointsPage{Endpoints: content, Page: Page{Size: 2, TotalElements: total, TotalPages: pages, Number: page}})
+	}
+
+	tests := []struct {
+		gock    func(*gock.Request)
+		name    string
+		want    []string
+		wantErr error
+	}{
+		{
+			func(gock *gock.Request) {
+				middleware(gock)
+				endpoints(0, 3, 2, "e12345678.a", "e12345678.b")
+				endpoints(1, 3, 2, "other.c")
+			},
+			"Multiple pages",
+			[]string{"e12345678.a", "e12345678.b", "other.c"},
+			nil,
+		},
+		{
+			func(gock *gock.Request) {
+				middleware(gock)
+				endpoints(0, 4, 2, "e12345678.a", "e12345678.b")
+				endpoints(1, 4, 2, "e12345678.b", "e12345678.c")
+			},
+			"Duplicate across pages",
+			[]string{"e12345678.a", "e12345678.b", "e12345678.c"},
+			ErrIncomplete,
+		},
+		{
+			func(gock *gock.Request) {
+				middleware(gock)
+				endpoints(0, 4, 2, "e12345678.a", "e12345678.b")
+				endpoints(1, 5, 3, "e12345678.c", "e12345678.d")
+			},
+			"Changed while paging",
+			[]string{"e12345678.a", "e12345678.b"},
+			ErrIncomplete,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.gock(createGock())
+			_, topics, err := starlify.GetMiddlewareTopics(context.Background())
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			var got []string
+			for _, topic := range topics {
+				got = append(got, topic.Name)
+			}
+			assert.Equal(t, tt.want, got)
+			gock.Off()
+		})
+	}
+}
+
 func TestClient_Ping(t *testing.T) {
 	defer gock.Off()
 
@@ -340,7 +391,7 @@ func TestClient_ReportError(t *testing.T) {
 			func(gock *gock.Request) {
 				gock.Patch("/agents/agent-id-123").
 					MatchType("json").
-					JSON(AgentRequest{Error: "An error"}).
+					JSON(map[string]string{"error": "An error"}).
 					Reply(200).
 					JSON(Agent{Id: "agent-id-123", Name: "Test agent", AgentType: "kafka"})
 			},
@@ -434,5 +485,65 @@ func TestClientGet(t *testing.T) {
 		})
 	}
 
-	validate(t, &testCase{})
+	defer gock.Off()
+
+	createGock().
+		Get("/agents/agent-id-123").
+		Reply(200).
+		JSON(Agent{Id: "agent-id-123", Name: "Test agent", AgentType: "kafka"})
+
+	validate(t, &testCase{
+		Name:          "Get agent",
+		Client:        createStarlifyClient(),
+		Path:          "/agents/agent-id-123",
+		ReturnType:    &Agent{},
+		ExpectedError: nil,
+	})
+}
+
+func TestClient_CreateConsumer(t *testing.T) {
+	defer gock.Off()
+
+	starlify := createStarlifyClient()
+
+	tests := []struct {
+		gock    func(*gock.Request)
+		name    string
+		wantErr bool
+	}{
+		{
+			func(gock *gock.Request) {
+				gock.Post("/endpoints/endpoint-id-123/endpointInteractions").
+					MatchType("json").
+					JSON(EndpointInteractionRequest{ConsumerGroup: "orders"}).
+					Reply(201).
+					JSON(EndpointInteraction{Id: "interaction-id-123", ConsumerGroup: "orders"})
+			},
+			"Create consumer",
+			false,
+		},
+		{
+			func(gock *gock.Request) {
+				gock.Post("/endpoints/endpoint-id-123/endpointInteractions").
+					Reply(404)
+			},
+			"Endpoint not found",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.gock(createGock())
+			err := starlify.CreateConsumer(context.Background(), TopicEndpoint{ID: "endpoint-id-123", Name: "e12345678.orders"}, "orders")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateConsumer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	assert.Equal(t, "/agents/{id}", route("/agents/agent-id-123"))
+	assert.Equal(t, "/middlewares/{id}/endpoints", route("/middlewares/system-id-123/endpoints"))
+	assert.Equal(t, "/systems/{id}/services", route("/systems/system-id-123/services?page=1"))
 }
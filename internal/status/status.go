@@ -0,0 +1,318 @@
+package status
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// System is the sync status of one configured system.
+type System struct {
+	Name        string    `json:"name"`
+	Direction   string    `json:"direction,omitempty"`
+	Initialised bool      `json:"initialised"`
+	Healthy     bool      `json:"healthy"`
+	Paused      bool      `json:"paused"`
+	Prefix      string    `json:"prefix,omitempty"`
+	LastSync    time.Time `json:"lastSync,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+	NextRun     time.Time `json:"nextRun,omitempty"`
+}
+
+// Prefix is a prefix of topics in a cluster that no configured system manages.
+type Prefix struct {
+	Cluster string `json:"cluster"`
+	Prefix  string `json:"prefix"`
+}
+
+// Orphan is a topic in a cluster without a prefix.
+type Orphan struct {
+	Cluster string `json:"cluster"`
+	Kind    string `json:"kind"`
+	Topic   string `json:"topic"`
+}
+
+var registry = struct {
+	sync.Mutex
+	systems   map[string]*System
+	unmanaged map[string][]string
+	orphans   map[string]map[string][]string
+	started   time.Time
+	lastCycle time.Time
+	nextCycle time.Time
+	cycles    int
+	requested []string
+	trigger   chan struct{}
+}{
+	systems:   make(map[string]*System),
+	unmanaged: make(map[string][]string),
+	orphans:   make(map[string]map[string][]string),
+	started:   time.Now(),
+	trigger:   make(chan struct{}, 1),
+}
+
+func get(name string) *System {
+	s, ok := registry.systems[name]
+	if !ok {
+		s = &System{Name: name}
+		registry.systems[name] = s
+	}
+	return s
+}
+
+// Initialised marks the system as successfully initialised. A system whose last initialisation or sync failed
+// stays not initialised until it syncs again, unless it is paused.
+func Initialised(name string, direction string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s := get(name)
+	if s.Healthy || s.LastErrorAt.IsZero() || s.Paused {
+		s.Initialised = true
+	}
+	s.Direction = direction
+}
+
+// Synced records a successful sync of the system.
+func Synced(name string, prefix string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s := get(name)
+	s.Initialised = true
+	s.Healthy = true
+	s.Prefix = prefix
+	s.LastSync = time.Now()
+}
+
+// Failed records a failed initialisation or sync of the system, which makes the agent not ready.
+func Failed(name string, err error) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s := get(name)
+	s.Initialised = false
+	s.Healthy = false
+	s.LastError = err.Error()
+	s.LastErrorAt = time.Now()
+}
+
+// CycleCompleted records that the sync loop went through all systems and that the next cycle starts at next.
+// Systems not in names are no longer configured and are forgotten.
+func CycleCompleted(names []string, next time.Time) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		seen[name] = true
+	}
+	for name := range registry.systems {
+		if !seen[name] {
+			delete(registry.systems, name)
+		}
+	}
+
+	registry.lastCycle = time.Now()
+	registry.nextCycle = next
+	registry.cycles++
+}
+
+// SetUnmanaged replaces the unmanaged prefixes of the clusters. Clusters not in unmanaged are kept.
+func SetUnmanaged(unmanaged map[string][]string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for cluster, prefixes := range unmanaged {
+		registry.unmanaged[cluster] = prefixes
+	}
+}
+
+// Unmanaged returns the unmanaged prefixes of all clusters, sorted by cluster and prefix.
+func Unmanaged() []Prefix {
+	registry.Lock()
+	defer registry.Unlock()
+
+	prefixes := make([]Prefix, 0)
+	for cluster, p := range registry.unmanaged {
+		for _, prefix := range p {
+			prefixes = append(prefixes, Prefix{Cluster: cluster, Prefix: prefix})
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].Cluster != prefixes[j].Cluster {
+			return prefixes[i].Cluster < prefixes[j].Cluster
+		}
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+	return prefixes
+}
+
+// SetOrphans replaces the orphaned topics by kind of the clusters. Clusters not in orphans are kept.
+func SetOrphans(orphans map[string]map[string][]string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for cluster, kinds := range orphans {
+		registry.orphans[cluster] = kinds
+	}
+}
+
+// Orphans returns the orphaned topics of all clusters, sorted by cluster and topic.
+func Orphans() []Orphan {
+	registry.Lock()
+	defer registry.Unlock()
+
+	orphans := make([]Orphan, 0)
+	for cluster, kinds := range registry.orphans {
+		for kind, topics := range kinds {
+			for _, topic := range topics {
+				orphans = append(orphans, Orphan{Cluster: cluster, Kind: kind, Topic: topic})
+			}
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Cluster != orphans[j].Cluster {
+			return orphans[i].Cluster < orphans[j].Cluster
+		}
+		return orphans[i].Topic < orphans[j].Topic
+	})
+	return orphans
+}
+
+// Systems returns the status of all systems sorted by name.
+func Systems() []System {
+	registry.Lock()
+	defer registry.Unlock()
+
+	systems := make([]System, 0, len(registry.systems))
+	for _, s := range registry.systems {
+		system := *s
+		if !system.Paused {
+			system.NextRun = registry.nextCycle
+		}
+		systems = append(systems, system)
+	}
+	sort.Slice(systems, func(i, j int) bool {
+		return systems[i].Name < systems[j].Name
+	})
+	return systems
+}
+
+// Ready reports whether a full cycle has completed and every system has been initialised and not failed since.
+func Ready() bool {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.cycles == 0 {
+		return false
+	}
+	for _, s := range registry.systems {
+		if !s.Initialised {
+			return false
+		}
+	}
+	return true
+}
+
+// Alive reports whether the sync loop has completed a cycle within staleness.
+// Before the first cycle, the time since start is used.
+func Alive(staleness time.Duration) bool {
+	registry.Lock()
+	defer registry.Unlock()
+
+	last := registry.lastCycle
+	if registry.cycles == 0 {
+		last = registry.started
+	}
+	return time.Since(last) <= staleness
+}
+
+// LastCycle returns when the sync loop last completed a cycle.
+func LastCycle() time.Time {
+	registry.Lock()
+	defer registry.Unlock()
+
+	return registry.lastCycle
+}
+
+// Find returns the status of the system called name, matched on the full name or the file name.
+func Find(name string) (System, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s, ok := find(name)
+	if !ok {
+		return System{}, false
+	}
+	return *s, true
+}
+
+func find(name string) (*System, bool) {
+	if s, ok := registry.systems[name]; ok {
+		return s, true
+	}
+	for _, s := range registry.systems {
+		if filepath.Base(s.Name) == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// SetPaused pauses or resumes the sync of the system. It reports false if the system is unknown.
+func SetPaused(name string, paused bool) bool {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s, ok := find(name)
+	if ok {
+		s.Paused = paused
+	}
+	return ok
+}
+
+// Paused reports whether the sync of the system is paused.
+func Paused(name string) bool {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s, ok := registry.systems[name]
+	return ok && s.Paused
+}
+
+// Trigger asks the sync loop to sync the system called name now, without waiting for the next cycle.
+func Trigger(name string) {
+	registry.Lock()
+	for _, requested := range registry.requested {
+		if requested == name {
+			registry.Unlock()
+			return
+		}
+	}
+	registry.requested = append(registry.requested, name)
+	registry.Unlock()
+
+	select {
+	case registry.trigger <- struct{}{}:
+	default:
+		// A sync is already pending.
+	}
+}
+
+// Triggered is signalled when a sync has been requested through Trigger.
+func Triggered() <-chan struct{} {
+	return registry.trigger
+}
+
+// Requested returns the names of the systems whose sync has been requested since the last call, in order.
+func Requested() []string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	requested := registry.requested
+	registry.requested = nil
+	return requested
+}
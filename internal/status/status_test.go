@@ -0,0 +1,104 @@
+package status
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyAndAlive(t *testing.T) {
+
+	assert.False(t, Ready())
+	assert.True(t, Alive(time.Minute))
+
+	Initialised("/configs/a.yaml", "starlify_to_kafka")
+	Failed("/configs/b.yaml", errors.New("agent type mismatch"))
+	CycleCompleted([]string{"/configs/a.yaml", "/configs/b.yaml"}, time.Now())
+	assert.False(t, Ready())
+
+	Initialised("/configs/b.yaml", "kafka_to_starlify")
+	Synced("/configs/b.yaml", "e12345678.")
+	assert.True(t, Ready())
+
+	CycleCompleted([]string{"/configs/b.yaml"}, time.Now())
+	systems := Systems()
+	assert.Len(t, systems, 1)
+	assert.Equal(t, "/configs/b.yaml", systems[0].Name)
+	assert.True(t, systems[0].Healthy)
+	assert.Equal(t, "agent type mismatch", systems[0].LastError)
+
+	assert.True(t, Alive(time.Minute))
+	assert.False(t, Alive(0))
+}
+
+func TestReadyAfterFailure(t *testing.T) {
+
+	Initialised("/configs/d.yaml", "starlify_to_kafka")
+	Synced("/configs/d.yaml", "e12345678.")
+	CycleCompleted([]string{"/configs/d.yaml"}, time.Now())
+	assert.True(t, Ready())
+
+	// A failed sync makes the agent not ready, also while the next sync runs.
+	Failed("/configs/d.yaml", errors.New("broker down"))
+	assert.False(t, Ready())
+	Initialised("/configs/d.yaml", "starlify_to_kafka")
+	assert.False(t, Ready())
+	s, _ := Find("d.yaml")
+	assert.False(t, s.Initialised)
+
+	Synced("/configs/d.yaml", "e12345678.")
+	assert.True(t, Ready())
+
+	CycleCompleted(nil, time.Now())
+}
+
+func TestPause(t *testing.T) {
+
+	Initialised("/configs/c.yaml", "starlify_to_kafka")
+
+	assert.False(t, SetPaused("unknown.yaml", true))
+	assert.True(t, SetPaused("c.yaml", true))
+	assert.True(t, Paused("/configs/c.yaml"))
+
+	s, ok := Find("c.yaml")
+	assert.True(t, ok)
+	assert.True(t, s.Paused)
+
+	assert.True(t, SetPaused("/configs/c.yaml", false))
+	assert.False(t, Paused("/configs/c.yaml"))
+}
+
+func TestTrigger(t *testing.T) {
+
+	assert.Empty(t, Requested())
+
+	Trigger("/configs/a.yaml")
+	Trigger("/configs/b.yaml")
+	Trigger("/configs/a.yaml")
+
+	select {
+	case <-Triggered():
+	default:
+		t.Fatal("sync not triggered")
+	}
+	assert.Equal(t, []string{"/configs/a.yaml", "/configs/b.yaml"}, Requested())
+	assert.Empty(t, Requested())
+}
+
+func TestUnmanaged(t *testing.T) {
+
+	assert.Empty(t, Unmanaged())
+
+	SetUnmanaged(map[string][]string{"b:9092": {"e87654321."}, "a:9092": {"e22222222.", "e11111111."}})
+	SetUnmanaged(map[string][]string{"c:9092": nil})
+	assert.Equal(t, []Prefix{
+		{Cluster: "a:9092", Prefix: "e11111111."},
+		{Cluster: "a:9092", Prefix: "e22222222."},
+		{Cluster: "b:9092", Prefix: "e87654321."},
+	}, Unmanaged())
+
+	SetUnmanaged(map[string][]string{"a:9092": nil})
+	assert.Equal(t, []Prefix{{Cluster: "b:9092", Prefix: "e87654321."}}, Unmanaged())
+}
@@ -0,0 +1,240 @@
+package system
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	pre "github.com/entiros/stargazer-kafka/internal/prefix"
+	stargazerkafka "github.com/entiros/stargazer-kafka/internal/stargazer-kafka"
+)
+
+// Discovery finds the prefixes in the clusters of the systems of a sync cycle that no system manages.
+type Discovery struct {
+	clusters map[string]*cluster
+}
+
+// cluster is what Discovery knows of one cluster.
+type cluster struct {
+	systems map[string]*System
+	managed map[string]bool
+	failed  map[string]bool
+	paused  map[string]bool
+}
+
+// reported are the unmanaged prefixes last reported to Starlify, by system. Systems are created
+// again every cycle, so it lives here.
+var reported = struct {
+	sync.Mutex
+	prefixes map[string]string
+}{
+	prefixes: make(map[string]string),
+}
+
+// known are the clusters of the systems by name, so that a system whose initialisation fails can still be
+// placed in the cluster it was last configured for.
+var known = struct {
+	sync.Mutex
+	clusters map[string]string
+}{
+	clusters: make(map[string]string),
+}
+
+// remember records the cluster of the system called name.
+func remember(name string, cluster string) {
+	known.Lock()
+	defer known.Unlock()
+	known.clusters[name] = cluster
+}
+
+// NewDiscovery returns a Discovery without systems.
+func NewDiscovery() *Discovery {
+	return &Discovery{clusters: make(map[string]*cluster)}
+}
+
+// Add adds the system and a prefix it manages. The prefix is empty if it is not known,
+// e.g. when the system never synced. A system can be added more than once.
+func (d *Discovery) Add(s *System, prefix string) {
+
+	c := d.cluster(s.cluster)
+	c.systems[s.Name()] = s
+	if prefix != "" {
+		c.managed[prefix] = true
+	}
+}
+
+// Pause marks the added system as paused, so it does not sync orphaned topics.
+func (d *Discovery) Pause(s *System) {
+	d.cluster(s.cluster).paused[s.Name()] = true
+}
+
+// AddFailed adds the system called name that failed to initialise, with the prefix of its last successful sync.
+// The prefix counts as managed in the cluster the system was last configured for. Systems never configured
+// are left out.
+func (d *Discovery) AddFailed(name string, prefix string) {
+
+	known.Lock()
+	key, ok := known.clusters[name]
+	known.Unlock()
+	if !ok {
+		return
+	}
+
+	c := d.cluster(key)
+	c.failed[name] = true
+	if prefix != "" {
+		c.managed[prefix] = true
+	}
+}
+
+// cluster returns what is known of the cluster, nothing yet if it is new.
+func (d *Discovery) cluster(key string) *cluster {
+
+	c, ok := d.clusters[key]
+	if !ok {
+		c = &cluster{systems: make(map[string]*System), managed: make(map[string]bool), failed: make(map[string]bool), paused: make(map[string]bool)}
+		d.clusters[key] = c
+	}
+	return c
+}
+
+// Unmanaged returns the sorted prefixes that no system manages, by cluster. Prefixes are found with the
+// prefix policy of every system of the cluster. Clusters that could not be read, or without a system that
+// initialised, are left out.
+func (d *Discovery) Unmanaged(ctx context.Context) map[string][]string {
+
+	unmanaged := make(map[string][]string)
+	for key, c := range d.clusters {
+		if len(c.systems) == 0 {
+			continue
+		}
+		found := make(map[string]bool)
+		failed := false
+		for _, s := range c.systems {
+			prefixes, err := s.ks.GetPrefixes(ctx)
+			if err != nil {
+				log.Ctx(ctx).Errorf("Failed to discover prefixes of %s with %s. %v", key, s.Name(), err)
+				failed = true
+				break
+			}
+			for _, prefix := range prefixes {
+				found[prefix] = true
+			}
+		}
+		if failed {
+			continue
+		}
+
+		var prefixes []string
+		for prefix := range found {
+			if !c.managed[prefix] {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		sort.Strings(prefixes)
+		unmanaged[key] = prefixes
+	}
+	return unmanaged
+}
+
+// Orphans returns the orphaned topics that are not ignored by kind, by cluster, and syncs the orphaned topics
+// to the unassigned middleware where configured. The orphan policy of a cluster is the one of its system
+// with the lowest name. Orphaned topics are not synced if that system is paused or a system of the cluster
+// failed to initialise. Clusters that could not be read are left out.
+func (d *Discovery) Orphans(ctx context.Context) map[string]map[string][]string {
+
+	orphans := make(map[string]map[string][]string)
+	for key, c := range d.clusters {
+		if len(c.systems) == 0 {
+			continue
+		}
+		var names []string
+		var policies []*pre.Policy
+		for name, s := range c.systems {
+			names = append(names, name)
+			policies = append(policies, s.ks.PrefixPolicy())
+		}
+		sort.Strings(names)
+
+		owner := c.systems[names[0]]
+		for _, name := range names[1:] {
+			if !reflect.DeepEqual(owner.orphans, c.systems[name].orphans) {
+				log.Ctx(ctx).Errorf("Orphan policy of %s differs from the one of %s used for %s", name, owner.Name(), key)
+			}
+		}
+
+		topics, err := owner.ks.GetAllTopics(ctx)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Failed to find orphaned topics of %s with %s. %v", key, owner.Name(), err)
+			continue
+		}
+		orphans[key] = owner.orphans.Classify(topics, policies)
+
+		var unassigned []string
+		middleware := false
+		for _, kind := range []string{stargazerkafka.OrphanUnprefixed, stargazerkafka.OrphanInternal} {
+			if owner.orphans.Action(kind) == stargazerkafka.OrphanMiddleware {
+				unassigned = append(unassigned, orphans[key][kind]...)
+				middleware = true
+			}
+		}
+		if !middleware || owner.cfg.Sync.Direction != ToStarlify {
+			continue
+		}
+
+		// Topics of a system that failed to initialise look orphaned, and a paused system must not write.
+		if len(c.failed) > 0 {
+			var failed []string
+			for name := range c.failed {
+				failed = append(failed, name)
+			}
+			sort.Strings(failed)
+			log.Ctx(ctx).Errorf("Not syncing orphaned topics of %s, systems failed to initialise: %v", key, failed)
+			continue
+		}
+		if c.paused[owner.Name()] {
+			log.Ctx(ctx).Debugf("Not syncing orphaned topics of %s, %s is paused", key, owner.Name())
+			continue
+		}
+
+		sort.Strings(unassigned)
+		err = owner.ks.SyncOrphansToStarlify(ctx, owner.orphans.MiddlewareId, unassigned)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Failed to sync orphaned topics of %s to middleware %s. %v", key, owner.orphans.MiddlewareId, err)
+		}
+	}
+	return orphans
+}
+
+// Report reports the unmanaged prefixes of its cluster to Starlify for every system with reporting enabled.
+// Prefixes are only reported when they changed since the last report of the system.
+func (d *Discovery) Report(ctx context.Context, unmanaged map[string][]string) {
+
+	reported.Lock()
+	defer reported.Unlock()
+
+	for key, c := range d.clusters {
+		prefixes, ok := unmanaged[key]
+		if !ok {
+			continue
+		}
+		for _, s := range c.systems {
+			if !s.cfg.Discovery.Report {
+				continue
+			}
+			joined := strings.Join(prefixes, ",")
+			if last, ok := reported.prefixes[s.Name()]; ok && last == joined {
+				continue
+			}
+			err := s.ks.ReportUnmanagedPrefixes(ctx, prefixes)
+			if err != nil {
+				log.Ctx(ctx).Errorf("Failed to report unmanaged prefixes of %s to Starlify. %v", s.Name(), err)
+				continue
+			}
+			reported.prefixes[s.Name()] = joined
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package system
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/config"
+	"github.com/entiros/stargazer-kafka/internal/kafka/fake"
+	stargazerkafka "github.com/entiros/stargazer-kafka/internal/stargazer-kafka"
+	"github.com/entiros/stargazer-kafka/internal/starlify"
+	starlifyfake "github.com/entiros/stargazer-kafka/internal/starlify/fake"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const clusterKey = "kafka:9092"
+
+// newStarlify returns a fake Starlify API and its base URL.
+func newStarlify(t *testing.T) (*starlifyfake.Server, string) {
+
+	gin.SetMode(gin.TestMode)
+
+	s := starlifyfake.New("api-key-123")
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return s, srv.URL + starlifyfake.BasePath
+}
+
+// newSystem returns the system called name on the cluster, syncing the middleware of its prefix to Starlify
+// with its own agent.
+func newSystem(t *testing.T, name string, cluster *fake.Cluster, s *starlifyfake.Server, baseUrl string, prefix string) *System {
+
+	s.AddMiddleware("middleware-"+name, name, prefix)
+	s.AddAgent("agent-"+name, stargazerkafka.KafkaType, "middleware-"+name)
+
+	cfg := &config.Config{}
+	cfg.Sync.Direction = ToStarlify
+	ks, err := stargazerkafka.InitKafkaTopicsToStarlify(context.Background(), name, cluster, &starlify.Client{
+		BaseUrl:      baseUrl,
+		ApiKey:       "api-key-123",
+		AgentId:      "agent-" + name,
+		MiddlewareId: "middleware-" + name,
+		Retry:        &starlify.RetryPolicy{MaxRetries: 1, Timeout: time.Second},
+	})
+	assert.NoError(t, err)
+
+	remember(name, clusterKey)
+	return &System{cfg: cfg, file: name, cluster: clusterKey, ks: ks, orphans: &stargazerkafka.OrphanPolicy{}}
+}
+
+func TestDiscovery_Unmanaged(t *testing.T) {
+
+	s, baseUrl := newStarlify(t)
+	cluster := fake.New("e12345678.orders", "e87654321.orders", "e11111111.orders", "orders")
+	orders := newSystem(t, "orders.yaml", cluster, s, baseUrl, "e12345678.")
+
+	d := NewDiscovery()
+	d.Add(orders, "")
+	d.Add(orders, "e12345678.")
+	assert.Equal(t, map[string][]string{clusterKey: {"e11111111.", "e87654321."}}, d.Unmanaged(context.Background()))
+
+	// The prefix of a system that failed to initialise stays managed.
+	newSystem(t, "payments.yaml", cluster, s, baseUrl, "e87654321.")
+	d.AddFailed("payments.yaml", "e87654321.")
+	d.AddFailed("unknown.yaml", "e11111111.")
+	assert.Equal(t, map[string][]string{clusterKey: {"e11111111."}}, d.Unmanaged(context.Background()))
+
+	// Clusters without a system that initialised can not be read.
+	d = NewDiscovery()
+	d.AddFailed("payments.yaml", "e87654321.")
+	assert.Empty(t, d.Unmanaged(context.Background()))
+}
+
+func TestDiscovery_Orphans(t *testing.T) {
+
+	s, baseUrl := newStarlify(t)
+	s.AddMiddleware("unassigned", "Unassigned", "")
+	cluster := fake.New("e12345678.orders", "orders", "__consumer_offsets")
+	orders := newSystem(t, "a-orders.yaml", cluster, s, baseUrl, "e12345678.")
+	orders.orphans = &stargazerkafka.OrphanPolicy{Unprefixed: stargazerkafka.OrphanMiddleware, Internal: stargazerkafka.OrphanReport, MiddlewareId: "unassigned"}
+	payments := newSystem(t, "b-payments.yaml", cluster, s, baseUrl, "e87654321.")
+	ctx := context.Background()
+	creates := func() int {
+		return s.Requests(http.MethodPost, "/middlewares/:id/endpoints")
+	}
+
+	// Orphaned topics are not synced while the owner is paused or a system failed to initialise.
+	d := NewDiscovery()
+	d.Add(orders, "e12345678.")
+	d.Add(payments, "")
+	d.Pause(orders)
+	orphans := map[string]map[string][]string{clusterKey: {
+		stargazerkafka.OrphanUnprefixed: {"orders"},
+		stargazerkafka.OrphanInternal:   {"__consumer_offsets"},
+	}}
+	assert.Equal(t, orphans, d.Orphans(ctx))
+	assert.Equal(t, 0, creates())
+
+	d = NewDiscovery()
+	d.Add(orders, "e12345678.")
+	d.AddFailed("b-payments.yaml", "e87654321.")
+	assert.Equal(t, orphans, d.Orphans(ctx))
+	assert.Equal(t, 0, creates())
+
+	d = NewDiscovery()
+	d.Add(orders, "e12345678.")
+	d.Add(payments, "")
+	assert.Equal(t, orphans, d.Orphans(ctx))
+	assert.Equal(t, []string{"orders"}, s.Endpoints("unassigned"))
+
+	// Without the action the middleware is left alone.
+	orders.orphans = &stargazerkafka.OrphanPolicy{Unprefixed: stargazerkafka.OrphanReport}
+	cluster.AddTopic("invoices", fake.Topic{})
+	d.Orphans(ctx)
+	assert.Equal(t, []string{"orders"}, s.Endpoints("unassigned"))
+}
+
+func TestDiscovery_Report(t *testing.T) {
+
+	s, baseUrl := newStarlify(t)
+	cluster := fake.New("e12345678.orders", "e87654321.orders")
+	orders := newSystem(t, "report-orders.yaml", cluster, s, baseUrl, "e12345678.")
+	orders.cfg.Discovery.Report = true
+	payments := newSystem(t, "report-payments.yaml", cluster, s, baseUrl, "e87654321.")
+	ctx := context.Background()
+	patches := func() int {
+		return s.Requests(http.MethodPatch, "/agents/:id")
+	}
+
+	d := NewDiscovery()
+	d.Add(orders, "e12345678.")
+	d.Add(payments, "")
+	unmanaged := d.Unmanaged(ctx)
+	d.Report(ctx, unmanaged)
+	assert.Equal(t, []string{"e87654321."}, s.AgentDetails("agent-report-orders.yaml").UnmanagedPrefixes)
+	assert.Nil(t, s.AgentDetails("agent-report-payments.yaml"))
+	assert.Equal(t, 1, patches())
+
+	// Prefixes are only reported again when they change.
+	d.Report(ctx, unmanaged)
+	assert.Equal(t, 1, patches())
+	d.Report(ctx, map[string][]string{clusterKey: nil})
+	assert.Empty(t, s.AgentDetails("agent-report-orders.yaml").UnmanagedPrefixes)
+	assert.Equal(t, 2, patches())
+}
@@ -3,23 +3,39 @@ package system
 import (
 	"context"
 	"fmt"
+	"github.com/entiros/stargazer-kafka/internal/audit"
 	"github.com/entiros/stargazer-kafka/internal/config"
 	"github.com/entiros/stargazer-kafka/internal/kafka"
 	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/mapping"
+	"github.com/entiros/stargazer-kafka/internal/prefix"
+	"github.com/entiros/stargazer-kafka/internal/schemaregistry"
 	stargazerkafka "github.com/entiros/stargazer-kafka/internal/stargazer-kafka"
 	"github.com/entiros/stargazer-kafka/internal/starlify"
+	"github.com/entiros/stargazer-kafka/internal/webhook"
+	"strings"
 )
 
 type System struct {
-	cfg  *config.Config
-	file string
-	ks   *stargazerkafka.KafkaTopicsToStarlify
+	cfg      *config.Config
+	file     string
+	cluster  string
+	ks       *stargazerkafka.KafkaTopicsToStarlify
+	orphans  *stargazerkafka.OrphanPolicy
+	notifier *webhook.Notifier
+	// principals are the principals of the ACLs, see SyncACLs.
+	principals []stargazerkafka.Principal
 }
 
 func (s *System) Name() string {
 	return s.file
 }
 
+// Direction returns the configured sync direction.
+func (s *System) Direction() string {
+	return s.cfg.Sync.Direction
+}
+
 var systems map[string]*System
 
 func init() {
@@ -30,15 +46,23 @@ func NewSystem(ctx context.Context, c string) (*System, error) {
 
 	cfg, err := config.LoadConfig(c)
 	if err != nil {
-		return nil, err
+		return nil, stargazerkafka.NewError(stargazerkafka.ConfigError, err)
 	}
 
 	s := &System{
-		cfg:  cfg,
-		file: c,
+		cfg:     cfg,
+		file:    c,
+		cluster: kafka.NewKafkaClient(kafka.WithBootstrapServers(cfg.Kafka.BootstrapServers...)).ClusterKey(),
+	}
+	remember(s.file, s.cluster)
+	s.notifier, err = s.webhooks()
+	if err != nil {
+		return nil, stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid webhooks for system %s. %v", s.file, err))
 	}
 	err = s.init(ctx)
 	if err != nil {
+		s.notifier.Health(err)
+		s.reportInitError(ctx, err)
 		return nil, err
 	}
 	return s, nil
@@ -47,73 +71,366 @@ func NewSystem(ctx context.Context, c string) (*System, error) {
 
 func (s *System) init(ctx context.Context) error {
 
-	// Starlify client
-	starlifyClient := starlify.Client{
-		BaseUrl:      s.cfg.Starlify.BaseUrl,
-		ApiKey:       s.cfg.Starlify.ApiKey,
-		AgentId:      s.cfg.Starlify.AgentId,
-		MiddlewareId: s.cfg.Starlify.MiddlewareId,
+	opts := []func(*kafka.Client){
+		kafka.WithBootstrapServers(s.cfg.Kafka.BootstrapServers...),
+		kafka.WithSession(kafka.Session),
+		kafka.WithNamesOnly(s.cfg.Kafka.Metadata.NamesOnly),
 	}
 
 	var kafkaClient *kafka.Client
 	if s.cfg.Kafka.Auth.IAM.Secret != "" && s.cfg.Kafka.Auth.IAM.Key != "" {
-		kafkaClient = kafka.NewKafkaClient(
-			kafka.WithBootstrapServers(s.cfg.Kafka.BootstrapServers...),
-			kafka.WithSession(kafka.Session),
+		kafkaClient = kafka.NewKafkaClient(append(opts,
 			kafka.WithIAM(s.cfg.Kafka.Auth.IAM.Key, s.cfg.Kafka.Auth.IAM.Secret),
-		)
+		)...)
 		log.Logger.Debugf("Created Kafka client with IAM")
 
 	} else if s.cfg.Kafka.Auth.Plain.Username != "" && s.cfg.Kafka.Auth.Plain.Password != "" {
-		kafkaClient = kafka.NewKafkaClient(
-			kafka.WithBootstrapServers(s.cfg.Kafka.BootstrapServers...),
-			kafka.WithSession(kafka.Session),
+		kafkaClient = kafka.NewKafkaClient(append(opts,
 			kafka.WithPassword(s.cfg.Kafka.Auth.Plain.Username, s.cfg.Kafka.Auth.Plain.Password),
-		)
+		)...)
 		log.Logger.Debugf("Created Kafka client with Plain")
 
 	} else if s.cfg.Kafka.Auth.OAuth.Token != "" {
-		kafkaClient = kafka.NewKafkaClient(
-			kafka.WithBootstrapServers(s.cfg.Kafka.BootstrapServers...),
-			kafka.WithSession(kafka.Session),
+		kafkaClient = kafka.NewKafkaClient(append(opts,
 			kafka.WithOAuth(s.cfg.Kafka.Auth.OAuth.Token),
-		)
+		)...)
 		log.Logger.Debugf("Created Kafka client with OAuth")
 
 	} else {
-		kafkaClient = kafka.NewKafkaClient(
-			kafka.WithBootstrapServers(s.cfg.Kafka.BootstrapServers...),
-			kafka.WithSession(kafka.Session),
-		)
+		kafkaClient = kafka.NewKafkaClient(opts...)
 		log.Logger.Debugf("Created Kafka client without authentication")
 
 	}
 
+	err := kafkaClient.Ping(ctx)
+	if err != nil {
+		return stargazerkafka.NewError(stargazerkafka.KafkaError, fmt.Errorf("failed to reach Kafka for system %s. %v", s.file, err))
+	}
+
 	// Create integration
-	kafkaTopicsToStarlify, err := stargazerkafka.InitKafkaTopicsToStarlify(ctx, kafkaClient, &starlifyClient)
+	kafkaTopicsToStarlify, err := stargazerkafka.InitKafkaTopicsToStarlify(ctx, s.file, kafkaClient, s.starlifyClient())
+	if err != nil {
+		return stargazerkafka.NewError(stargazerkafka.Category(err), fmt.Errorf("failed to initialize system %s. %v", s.file, err))
+	}
+
+	rules, err := s.mapping()
+	if err != nil {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid mapping for system %s. %v", s.file, err))
+	}
+
+	policy := &prefix.Policy{
+		Pattern:    s.cfg.Prefix.Pattern,
+		Separators: s.cfg.Prefix.Separators,
+		MinLength:  s.cfg.Prefix.MinLength,
+		MaxLength:  s.cfg.Prefix.MaxLength,
+		Topics:     s.cfg.Prefix.Topics,
+	}
+	if err := policy.Check(); err != nil {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid prefix policy for system %s. %v", s.file, err))
+	}
+
+	s.orphans = &stargazerkafka.OrphanPolicy{
+		Unprefixed:     s.cfg.Orphans.Unprefixed,
+		Internal:       s.cfg.Orphans.Internal,
+		InternalTopics: s.cfg.Orphans.InternalTopics,
+		MiddlewareId:   s.cfg.Orphans.MiddlewareId,
+	}
+	if err := s.orphans.Validate(); err != nil {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid orphan policy for system %s. %v", s.file, err))
+	}
+	if s.orphans.MiddlewareId != "" && s.orphans.MiddlewareId == s.cfg.Starlify.MiddlewareId {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("orphaned topics of system %s must have their own middleware", s.file))
+	}
+	if s.orphans.MiddlewareId != "" && s.cfg.Sync.Direction != ToStarlify {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("orphaned topics of system %s can only be synced to a middleware with direction %s", s.file, ToStarlify))
+	}
+
+	trail, err := s.audit(kafkaClient, policy)
 	if err != nil {
-		return fmt.Errorf("failed to initialize system %s. %v", s.file, err)
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid audit for system %s. %v", s.file, err))
 	}
 
+	schemas, err := s.schemas()
+	if err != nil {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid schema registry for system %s. %v", s.file, err))
+	}
+	s.principals, err = s.aclPrincipals()
+	if err != nil {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid ACL principals for system %s. %v", s.file, err))
+	}
+
+	if err := s.checkAttributes(); err != nil {
+		return stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("invalid attributes for system %s. %v", s.file, err))
+	}
+
+	kafkaTopicsToStarlify.SetAttributes(s.cfg.Sync.Attributes)
+	kafkaTopicsToStarlify.SetSchemas(schemas)
+	kafkaTopicsToStarlify.SetSampling(s.sampling())
+	kafkaTopicsToStarlify.SetMapping(rules)
+	kafkaTopicsToStarlify.SetPrefixPolicy(policy)
+	kafkaTopicsToStarlify.SetAudit(trail)
+	kafkaTopicsToStarlify.SetNotifier(s.notifier)
 	s.ks = kafkaTopicsToStarlify
 
 	return nil
 }
 
+// starlifyClient returns a client of the Starlify agent of the system.
+func (s *System) starlifyClient() *starlify.Client {
+	return &starlify.Client{
+		BaseUrl:       s.cfg.Starlify.BaseUrl,
+		ApiKey:        s.cfg.Starlify.ApiKey,
+		AgentId:       s.cfg.Starlify.AgentId,
+		MiddlewareId:  s.cfg.Starlify.MiddlewareId,
+		RateLimit:     s.cfg.Starlify.RateLimit,
+		Burst:         s.cfg.Starlify.Burst,
+		MaxConcurrent: s.cfg.Starlify.MaxConcurrent,
+	}
+}
+
+// mapping returns the validated mapping rules of the system, nil if endpoint names are topic names.
+func (s *System) mapping() (*mapping.Rules, error) {
+
+	m := s.cfg.Mapping
+	if !m.AddPrefix && m.Case == "" && len(m.Replace) == 0 && m.Template == "" {
+		return nil, nil
+	}
+
+	rules := &mapping.Rules{
+		AddPrefix: m.AddPrefix,
+		Case:      m.Case,
+		Template:  m.Template,
+		Variables: m.Variables,
+	}
+	for _, r := range m.Replace {
+		rules.Replace = append(rules.Replace, mapping.Replacement{From: r.From, To: r.To})
+	}
+	return rules, rules.Validate()
+}
+
+// audit returns the audit trail of the system, with the audit sinks and CloudEvents, nil if it has no sinks.
+// The topics of the sinks must not be ones the system could delete.
+func (s *System) audit(producer kafka.Producer, policy *prefix.Policy) (*audit.Trail, error) {
+
+	managed := func(topic string) bool {
+		_, ok := policy.Extract(topic)
+		return ok || len(policy.Topics) > 0 && policy.Manages("", topic)
+	}
+
+	a := s.cfg.Audit
+	var sinks []audit.Sink
+	if a.File != "" {
+		sinks = append(sinks, &audit.FileSink{Path: a.File})
+	}
+	if a.Topic != "" {
+		if managed(a.Topic) {
+			return nil, fmt.Errorf("audit topic %s must not be a managed topic", a.Topic)
+		}
+		sinks = append(sinks, &audit.KafkaSink{Producer: producer, Topic: a.Topic})
+	}
+	if e := s.cfg.CloudEvents; e.Topic != "" {
+		if managed(e.Topic) {
+			return nil, fmt.Errorf("CloudEvents topic %s must not be a managed topic", e.Topic)
+		}
+		sinks = append(sinks, &audit.CloudEventsSink{Producer: producer, Topic: e.Topic, Source: e.Source})
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return &audit.Trail{System: s.file, Direction: s.cfg.Sync.Direction, Sinks: sinks}, nil
+}
+
+// webhooks returns the notifier of the webhooks of the system, nil if it has none.
+func (s *System) webhooks() (*webhook.Notifier, error) {
+
+	w := s.cfg.Webhooks
+	if len(w.Hooks) == 0 {
+		return nil, nil
+	}
+
+	notifier := &webhook.Notifier{
+		System:     s.file,
+		Retries:    w.Retries,
+		Backoff:    w.Backoff,
+		DeadLetter: w.DeadLetter,
+	}
+	for _, h := range w.Hooks {
+		hook := webhook.Hook{URL: h.URL, Format: h.Format, Events: h.Events, Headers: h.Headers}
+		if err := hook.Validate(); err != nil {
+			return nil, err
+		}
+		notifier.Hooks = append(notifier.Hooks, hook)
+	}
+	return notifier, nil
+}
+
+// checkAttributes checks that the features publishing endpoint attributes are not configured without them.
+func (s *System) checkAttributes() error {
+
+	if s.cfg.Sync.Attributes {
+		return nil
+	}
+	if s.cfg.SchemaRegistry.URL != "" && s.cfg.Sync.Direction == ToStarlify {
+		return fmt.Errorf("schemas of the Schema Registry are published as attributes, which needs sync.attributes")
+	}
+	if s.cfg.Sampling.Enabled {
+		return fmt.Errorf("sampled payload formats are published as attributes, which needs sync.attributes")
+	}
+	return nil
+}
+
+// sampling returns how to sample the payloads of topics, nil if sampling is off.
+func (s *System) sampling() *stargazerkafka.Sampling {
+
+	if !s.cfg.Sampling.Enabled || s.cfg.Sampling.Records <= 0 {
+		return nil
+	}
+	return &stargazerkafka.Sampling{
+		Records:   s.cfg.Sampling.Records,
+		Interval:  s.cfg.Sampling.Interval,
+		Timeout:   s.cfg.Sampling.Timeout,
+		MaxTopics: s.cfg.Sampling.MaxTopics,
+	}
+}
+
+// schemas returns what to publish of the Schema Registry, nil if no registry is configured.
+func (s *System) schemas() (*stargazerkafka.Schemas, error) {
+
+	r := s.cfg.SchemaRegistry
+	if r.URL == "" {
+		if r.Lifecycle.Enabled {
+			return nil, fmt.Errorf("the subject lifecycle needs the url of the Schema Registry")
+		}
+		return nil, nil
+	}
+	switch r.Strategy {
+	case schemaregistry.TopicNameStrategy, schemaregistry.TopicRecordNameStrategy:
+	default:
+		return nil, fmt.Errorf("invalid strategy '%s', valid values are %s or %s", r.Strategy, schemaregistry.TopicNameStrategy, schemaregistry.TopicRecordNameStrategy)
+	}
+	for _, subject := range r.Subjects {
+		if !strings.Contains(subject, "{topic}") {
+			return nil, fmt.Errorf("subject template '%s' must contain {topic}", subject)
+		}
+	}
+
+	var lifecycle *stargazerkafka.SubjectLifecycle
+	if r.Lifecycle.Enabled {
+		if r.Strategy != schemaregistry.TopicNameStrategy && len(r.Subjects) == 0 {
+			return nil, fmt.Errorf("the subject lifecycle needs strategy %s or subjects", schemaregistry.TopicNameStrategy)
+		}
+		if r.Lifecycle.SchemaAttribute == "" {
+			return nil, fmt.Errorf("the subject lifecycle needs a schemaAttribute")
+		}
+		lifecycle = &stargazerkafka.SubjectLifecycle{
+			SchemaAttribute: r.Lifecycle.SchemaAttribute,
+			Compatibility:   r.Lifecycle.Compatibility,
+			DryRun:          r.Lifecycle.DryRun,
+		}
+	}
+
+	return &stargazerkafka.Schemas{
+		Registry: &schemaregistry.Client{
+			URL:                r.URL,
+			Username:           r.Username,
+			Password:           r.Password,
+			CAFile:             r.TLS.CAFile,
+			CertFile:           r.TLS.CertFile,
+			KeyFile:            r.TLS.KeyFile,
+			InsecureSkipVerify: r.TLS.InsecureSkipVerify,
+		},
+		Strategy:      r.Strategy,
+		Subjects:      r.Subjects,
+		IncludeSchema: r.IncludeSchema,
+		Lifecycle:     lifecycle,
+	}, nil
+}
+
 var ToKafka = "starlify_to_kafka"
 var ToStarlify = "kafka_to_starlify"
 
+// SyncTopics syncs the topics in the configured direction, and notifies the webhooks when the system
+// starts failing or recovers.
 func (s *System) SyncTopics(ctx context.Context) (string, error) {
 
+	prefix, err := s.syncTopics(ctx)
+	s.notifier.Health(err)
+	return prefix, err
+}
+
+func (s *System) syncTopics(ctx context.Context) (string, error) {
+
 	if s.cfg.Sync.Direction == ToKafka {
 		return s.ks.SyncTopicsToKafka(ctx)
 	} else if s.cfg.Sync.Direction == ToStarlify {
-		return s.ks.SyncTopicsToStarlify(ctx)
+		prefix, err := s.ks.SyncTopicsToStarlify(ctx)
+		if err != nil || !s.cfg.Sync.ConsumerGroups {
+			return prefix, err
+		}
+		return prefix, s.ks.SyncConsumersToStarlify(ctx)
 	}
 
-	return "", fmt.Errorf("Skipping sync of '%s'. %s is an invalid sync direction. Valid values are %s or %s", s.file, s.cfg.Sync.Direction, ToKafka, ToStarlify)
+	return "", stargazerkafka.NewError(stargazerkafka.ConfigError, fmt.Errorf("Skipping sync of '%s'. %s is an invalid sync direction. Valid values are %s or %s", s.file, s.cfg.Sync.Direction, ToKafka, ToStarlify))
+}
+
+// SyncACLs will create and remove Kafka ACLs from Starlify producers and consumers, if enabled.
+func (s *System) SyncACLs(ctx context.Context) error {
+
+	if !s.cfg.ACL.Enabled {
+		return nil
+	}
+
+	return s.ks.SyncACLs(ctx, s.principals, s.cfg.ACL.Host)
+}
+
+// aclPrincipals returns the principals whose ACLs follow Starlify, none if ACLs are not enabled.
+func (s *System) aclPrincipals() ([]stargazerkafka.Principal, error) {
+
+	if !s.cfg.ACL.Enabled {
+		return nil, nil
+	}
+
+	var principals []stargazerkafka.Principal
+	for _, p := range s.cfg.ACL.Principals {
+		principal := stargazerkafka.Principal{
+			SystemId:    p.System,
+			Principal:   p.Principal,
+			GroupPrefix: p.GroupPrefix,
+		}
+		if err := principal.Validate(); err != nil {
+			return nil, err
+		}
+		principals = append(principals, principal)
+	}
+	return principals, nil
+}
+
+// ReportLag will export consumer lag and throughput metrics for the topics under prefix, if enabled.
+func (s *System) ReportLag(ctx context.Context, prefix string) error {
+	return s.ks.ReportLag(ctx, s.Name(), prefix, s.cfg.Metrics.ConsumerLag, s.cfg.Metrics.Throughput)
 }
 
 func (s *System) PingStarlify(ctx context.Context) error {
-	return s.ks.Ping(ctx)
+	return stargazerkafka.NewError(stargazerkafka.StarlifyError, s.ks.Ping(ctx))
+}
+
+// ReportError shows err on the Starlify agent of the system, unless the agent already shows it.
+func (s *System) ReportError(ctx context.Context, err error) error {
+	return stargazerkafka.NewError(stargazerkafka.StarlifyError, s.ks.ReportError(ctx, err))
+}
+
+// ClearError clears the error shown on the Starlify agent of the system.
+func (s *System) ClearError(ctx context.Context) error {
+	return stargazerkafka.NewError(stargazerkafka.StarlifyError, s.ks.ClearError(ctx))
+}
+
+// reportInitError shows err, which failed the initialisation of the system, on its Starlify agent if it has one.
+func (s *System) reportInitError(ctx context.Context, err error) {
+
+	if s.cfg.Starlify.BaseUrl == "" || s.cfg.Starlify.AgentId == "" {
+		return
+	}
+	if reportErr := stargazerkafka.ReportError(ctx, s.starlifyClient(), err); reportErr != nil {
+		log.Logger.Errorf("Failed to report error of system %s to Starlify. %v", s.file, reportErr)
+	}
 }
@@ -0,0 +1,58 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/entiros/stargazer-kafka/internal/config"
+	stargazerkafka "github.com/entiros/stargazer-kafka/internal/stargazer-kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystem_CheckAttributes(t *testing.T) {
+
+	cfg := &config.Config{}
+	cfg.Sync.Direction = ToStarlify
+	s := &System{cfg: cfg, file: "orders.yaml"}
+	assert.NoError(t, s.checkAttributes())
+
+	cfg.SchemaRegistry.URL = "http://schema-registry:8081"
+	assert.Error(t, s.checkAttributes())
+	cfg.Sync.Attributes = true
+	assert.NoError(t, s.checkAttributes())
+
+	// The subject lifecycle of starlify_to_kafka does not publish attributes.
+	cfg.Sync.Attributes = false
+	cfg.Sync.Direction = ToKafka
+	assert.NoError(t, s.checkAttributes())
+
+	cfg.Sampling.Enabled = true
+	assert.Error(t, s.checkAttributes())
+	cfg.Sync.Attributes = true
+	assert.NoError(t, s.checkAttributes())
+}
+
+func TestSystem_ACLPrincipals(t *testing.T) {
+
+	cfg := &config.Config{}
+	s := &System{cfg: cfg, file: "orders.yaml"}
+	cfg.ACL.Principals = append(cfg.ACL.Principals, struct {
+		System      string `yaml:"system"`
+		Principal   string `yaml:"principal"`
+		GroupPrefix string `yaml:"groupPrefix"`
+	}{System: "", Principal: "User:"})
+
+	// Principals are only checked when ACLs are enabled.
+	principals, err := s.aclPrincipals()
+	assert.NoError(t, err)
+	assert.Empty(t, principals)
+
+	cfg.ACL.Enabled = true
+	_, err = s.aclPrincipals()
+	assert.Error(t, err)
+
+	cfg.ACL.Principals[0].System = "system-id-123"
+	cfg.ACL.Principals[0].Principal = "User:orders"
+	principals, err = s.aclPrincipals()
+	assert.NoError(t, err)
+	assert.Equal(t, []stargazerkafka.Principal{{SystemId: "system-id-123", Principal: "User:orders"}}, principals)
+}
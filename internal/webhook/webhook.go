@@ -0,0 +1,331 @@
+// Package webhook notifies outbound webhooks of what the agent does, in generic JSON, Slack or Microsoft Teams
+// payloads. Notifications are queued and delivered in the background, so a broken webhook never blocks a sync.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/entiros/stargazer-kafka/internal/log"
+	"github.com/entiros/stargazer-kafka/internal/metrics"
+	"github.com/go-resty/resty/v2"
+)
+
+// Events notified.
+const (
+	TopicsCreated    = "topics.created"
+	TopicsDeleted    = "topics.deleted"
+	EndpointsCreated = "endpoints.created"
+	EndpointsDeleted = "endpoints.deleted"
+	// DeletionBlocked is a deletion safeguard tripping, e.g. deletes skipped after an incomplete listing.
+	DeletionBlocked = "deletion.blocked"
+	SystemFailing   = "system.failing"
+	SystemHealthy   = "system.healthy"
+)
+
+// Payload formats.
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+	FormatTeams = "teams"
+)
+
+// Results of deliveries, used to label metrics.
+const (
+	Delivered = "delivered"
+	Failed    = "failed"
+	Dropped   = "dropped"
+)
+
+// QueueSize is how many notifications wait for delivery before new ones go to the dead-letter log.
+const QueueSize = 1000
+
+// Hook is a webhook to notify.
+type Hook struct {
+	URL string
+	// Format is FormatJSON, FormatSlack or FormatTeams, FormatJSON if empty.
+	Format string
+	// Events are the events to notify, all if empty.
+	Events  []string
+	Headers map[string]string
+}
+
+// Validate checks the URL, format and events of the hook.
+func (h *Hook) Validate() error {
+
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url '%s'", h.URL)
+	}
+	switch h.Format {
+	case "", FormatJSON, FormatSlack, FormatTeams:
+	default:
+		return fmt.Errorf("invalid webhook format '%s', valid values are %s, %s or %s", h.Format, FormatJSON, FormatSlack, FormatTeams)
+	}
+	for _, event := range h.Events {
+		switch event {
+		case TopicsCreated, TopicsDeleted, EndpointsCreated, EndpointsDeleted, DeletionBlocked, SystemFailing, SystemHealthy:
+		default:
+			return fmt.Errorf("invalid webhook event '%s'", event)
+		}
+	}
+	return nil
+}
+
+// String returns the host of the hook, the rest of the URL of e.g. Slack webhooks is a secret.
+func (h *Hook) String() string {
+	if u, err := url.Parse(h.URL); err == nil {
+		return u.Host
+	}
+	return "webhook"
+}
+
+func (h *Hook) wants(event string) bool {
+
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is what happened, the body of generic JSON webhooks.
+type Notification struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	System  string    `json:"system"`
+	Prefix  string    `json:"prefix,omitempty"`
+	Names   []string  `json:"names,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Notifier notifies the hooks of a system. A nil Notifier notifies nothing.
+type Notifier struct {
+	System string
+	Hooks  []Hook
+	// Retries is the number of retries after the first attempt, Backoff the delay before the first retry,
+	// doubled for every retry after that.
+	Retries int
+	Backoff time.Duration
+	// DeadLetter is the JSON-lines file of notifications that could not be delivered, the log if empty.
+	DeadLetter string
+}
+
+// delivery is a notification to deliver to a hook.
+type delivery struct {
+	notifier     *Notifier
+	hook         Hook
+	notification Notification
+}
+
+var queue = make(chan delivery, QueueSize)
+
+// health is the last health notified of each system. Systems are assumed healthy until they fail.
+var health = struct {
+	sync.Mutex
+	failing map[string]bool
+}{failing: make(map[string]bool)}
+
+// Notify queues the notification of event for the hooks that want it, without waiting for the deliveries.
+// Names are the topics or endpoints the event is about.
+func (n *Notifier) Notify(event string, prefix string, message string, names ...string) {
+
+	if n == nil || len(n.Hooks) == 0 {
+		return
+	}
+
+	notification := Notification{
+		Event:   event,
+		Time:    time.Now().UTC(),
+		System:  n.System,
+		Prefix:  prefix,
+		Names:   names,
+		Message: message,
+	}
+	for _, hook := range n.Hooks {
+		if !hook.wants(event) {
+			continue
+		}
+		select {
+		case queue <- delivery{notifier: n, hook: hook, notification: notification}:
+		default:
+			n.deadLetter(hook, notification, fmt.Errorf("queue full"))
+			metrics.WebhookDeliveries.WithLabelValues(n.System, Dropped).Inc()
+		}
+	}
+}
+
+// Health notifies SystemFailing when the system fails after being healthy, and SystemHealthy when it
+// recovers, with err nil.
+func (n *Notifier) Health(err error) {
+
+	if n == nil {
+		return
+	}
+
+	health.Lock()
+	failing := err != nil
+	changed := health.failing[n.System] != failing
+	health.failing[n.System] = failing
+	health.Unlock()
+
+	if !changed {
+		return
+	}
+	if failing {
+		n.Notify(SystemFailing, "", fmt.Sprintf("System %s is failing: %v", n.System, err))
+	} else {
+		n.Notify(SystemHealthy, "", fmt.Sprintf("System %s is healthy again", n.System))
+	}
+}
+
+// Run delivers queued notifications with workers until ctx is done. Notifications still queued then
+// go to the dead-letter log.
+func Run(ctx context.Context, workers int) {
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := resty.New().SetTimeout(10 * time.Second)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-queue:
+					d.notifier.deliver(ctx, client, d.hook, d.notification)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for {
+		select {
+		case d := <-queue:
+			d.notifier.deadLetter(d.hook, d.notification, fmt.Errorf("shut down before delivery"))
+			metrics.WebhookDeliveries.WithLabelValues(d.notifier.System, Dropped).Inc()
+		default:
+			return
+		}
+	}
+}
+
+// deliver posts the notification to the hook, retrying failures, and writes it to the dead-letter log
+// if it can't be delivered.
+func (n *Notifier) deliver(ctx context.Context, client *resty.Client, hook Hook, notification Notification) {
+
+	body, err := payload(hook.Format, notification)
+	if err == nil {
+		for attempt := 0; ; attempt++ {
+			err = post(ctx, client, hook, body)
+			if err == nil || attempt >= n.Retries {
+				break
+			}
+			log.Logger.Debugf("Retrying notification of %s to %v: %v", notification.Event, &hook, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(n.Backoff << attempt):
+			}
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		n.deadLetter(hook, notification, err)
+		metrics.WebhookDeliveries.WithLabelValues(n.System, Failed).Inc()
+		return
+	}
+	metrics.WebhookDeliveries.WithLabelValues(n.System, Delivered).Inc()
+}
+
+func post(ctx context.Context, client *resty.Client, hook Hook, body []byte) error {
+
+	response, err := client.R().
+		SetContext(ctx).
+		SetHeaders(hook.Headers).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(hook.URL)
+	if err != nil {
+		return err
+	}
+	if response.IsError() {
+		return fmt.Errorf("%s", response.Status())
+	}
+	return nil
+}
+
+// payload returns the body of the notification in format.
+func payload(format string, notification Notification) ([]byte, error) {
+
+	switch format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": notification.Message})
+	case FormatTeams:
+		color := "2EB886"
+		if notification.Event == SystemFailing || notification.Event == DeletionBlocked || strings.HasSuffix(notification.Event, ".deleted") {
+			color = "E01E5A"
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    notification.Message,
+			"themeColor": color,
+			"title":      "Stargazer " + notification.Event,
+			"text":       notification.Message,
+		})
+	default:
+		return json.Marshal(notification)
+	}
+}
+
+// deadLetters serializes the writes to dead-letter files.
+var deadLetters sync.Mutex
+
+// deadLetter records a notification that could not be delivered.
+func (n *Notifier) deadLetter(hook Hook, notification Notification, reason error) {
+
+	line, err := json.Marshal(struct {
+		Time         time.Time    `json:"time"`
+		Hook         string       `json:"hook"`
+		Error        string       `json:"error"`
+		Notification Notification `json:"notification"`
+	}{time.Now().UTC(), hook.String(), reason.Error(), notification})
+	if err != nil {
+		return
+	}
+
+	if n.DeadLetter == "" {
+		log.Logger.Errorf("Failed to notify %v: %s", &hook, line)
+		return
+	}
+
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+
+	f, err := os.OpenFile(n.DeadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Logger.Errorf("Failed to write to dead-letter log %s: %v. Failed to notify %v: %s", n.DeadLetter, err, &hook, line)
+	}
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is a webhook that fails the first failures requests.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	bodies   []map[string]any
+	headers  []http.Header
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var body map[string]any
+	data, _ := io.ReadAll(req.Body)
+	_ = json.Unmarshal(data, &body)
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header)
+}
+
+func (r *receiver) received() []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]map[string]any(nil), r.bodies...)
+}
+
+func TestHook_Validate(t *testing.T) {
+
+	assert.NoError(t, (&Hook{URL: "https://hooks.slack.com/services/x", Format: FormatSlack, Events: []string{TopicsDeleted}}).Validate())
+	assert.Error(t, (&Hook{URL: "hooks.slack.com"}).Validate())
+	assert.Error(t, (&Hook{URL: "https://example.com", Format: "xml"}).Validate())
+	assert.Error(t, (&Hook{URL: "https://example.com", Events: []string{"topic.renamed"}}).Validate())
+	assert.Equal(t, "hooks.slack.com", (&Hook{URL: "https://hooks.slack.com/services/secret"}).String())
+}
+
+func TestNotifier_Deliver(t *testing.T) {
+
+	r := &receiver{failures: 1}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n := &Notifier{System: "orders.yaml", Retries: 1, Backoff: time.Millisecond}
+	notification := Notification{Event: TopicsCreated, System: "orders.yaml", Prefix: "e12345678.", Names: []string{"e12345678.orders"}, Message: "created"}
+
+	// Failures are retried.
+	n.deliver(context.Background(), resty.New(), Hook{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}}, notification)
+	n.deliver(context.Background(), resty.New(), Hook{URL: srv.URL, Format: FormatSlack}, notification)
+	n.deliver(context.Background(), resty.New(), Hook{URL: srv.URL, Format: FormatTeams}, notification)
+
+	bodies := r.received()
+	assert.Len(t, bodies, 3)
+	assert.Equal(t, TopicsCreated, bodies[0]["event"])
+	assert.Equal(t, []any{"e12345678.orders"}, bodies[0]["names"])
+	assert.Equal(t, "secret", r.headers[0].Get("X-Token"))
+	assert.Equal(t, map[string]any{"text": "created"}, bodies[1])
+	assert.Equal(t, "MessageCard", bodies[2]["@type"])
+	assert.Equal(t, "created", bodies[2]["text"])
+}
+
+func TestNotifier_DeadLetter(t *testing.T) {
+
+	r := &receiver{failures: 10}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	n := &Notifier{System: "orders.yaml", Retries: 2, Backoff: time.Millisecond, DeadLetter: path}
+	n.deliver(context.Background(), resty.New(), Hook{URL: srv.URL + "/secret"}, Notification{Event: TopicsDeleted, Message: "deleted"})
+
+	assert.Equal(t, 7, r.failures)
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var line struct {
+		Hook         string       `json:"hook"`
+		Error        string       `json:"error"`
+		Notification Notification `json:"notification"`
+	}
+	assert.NoError(t, json.Unmarshal(content, &line))
+	assert.NotContains(t, line.Hook, "secret")
+	assert.Contains(t, line.Error, "503")
+	assert.Equal(t, TopicsDeleted, line.Notification.Event)
+}
+
+func TestNotifier_Notify(t *testing.T) {
+
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Run(ctx, 1)
+
+	n := &Notifier{System: t.Name(), Hooks: []Hook{
+		{URL: srv.URL, Events: []string{SystemFailing, SystemHealthy}},
+	}}
+
+	// Only the events of the hook, and only changes of health, are notified.
+	n.Notify(TopicsCreated, "e12345678.", "created", "e12345678.orders")
+	n.Health(nil)
+	n.Health(errors.New("kafka unreachable"))
+	n.Health(errors.New("kafka still unreachable"))
+	n.Health(nil)
+
+	assert.Eventually(t, func() bool { return len(r.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	bodies := r.received()
+	assert.Equal(t, SystemFailing, bodies[0]["event"])
+	assert.Contains(t, bodies[0]["message"], "kafka unreachable")
+	assert.Equal(t, SystemHealthy, bodies[1]["event"])
+
+	var none *Notifier
+	none.Notify(TopicsCreated, "", "created")
+	none.Health(errors.New("failing"))
+}
+
+func TestRun_Shutdown(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	n := &Notifier{System: t.Name(), Hooks: []Hook{{URL: "http://localhost:1/hook"}}, DeadLetter: path}
+
+	// Notifications still queued on shutdown are not lost.
+	n.Notify(TopicsDeleted, "e12345678.", "deleted", "e12345678.orders")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Run(ctx, 1)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var line struct {
+		Notification Notification `json:"notification"`
+	}
+	assert.NoError(t, json.Unmarshal(content, &line))
+	assert.Equal(t, TopicsDeleted, line.Notification.Event)
+	assert.Equal(t, []string{"e12345678.orders"}, line.Notification.Names)
+}